@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 )
 
 // вы можете использовать ApiError в коде, который получается в результате генерации
@@ -26,6 +27,7 @@ const (
 	statusAdmin     = 20
 )
 
+// apigen:service {"prefix": "/v1"}
 type MyApi struct {
 	statuses map[string]int
 	users    map[string]*User
@@ -118,11 +120,57 @@ func (srv *MyApi) Create(ctx context.Context, in CreateParams) (*NewUser, error)
 	return &NewUser{id}, nil
 }
 
+type StatusParams struct {
+	Login string `apivalidator:"path"`
+}
+
+type ByIDParams struct {
+	ID uint `apivalidator:"path,required"`
+}
+
+type UserStatus struct {
+	Login  string `json:"login"`
+	Status string `json:"status"`
+}
+
+// apigen:api {"url": "/user/{login}/status"}
+func (srv *MyApi) Status(ctx context.Context, in StatusParams) (*UserStatus, error) {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+
+	user, exist := srv.users[in.Login]
+	if !exist {
+		return nil, ApiError{http.StatusNotFound, fmt.Errorf("user not exist")}
+	}
+
+	for name, status := range srv.statuses {
+		if status == user.Status {
+			return &UserStatus{Login: user.Login, Status: name}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown status %d", user.Status)
+}
+
+// /user/id/{id} проверяется раньше /user/{login}/status
+// apigen:api {"url": "/user/id/{id}"}
+func (srv *MyApi) ByID(ctx context.Context, in ByIDParams) (*User, error) {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+
+	for _, user := range srv.users {
+		if user.ID == uint64(in.ID) {
+			return user, nil
+		}
+	}
+	return nil, ApiError{http.StatusNotFound, fmt.Errorf("user not exist")}
+}
+
 // 2-я часть
 // это похожая структура, с теми же методами, но у них другие параметры!
 // код, созданный вашим кодогенератором работает с конкретной струткурой, про другие ничего не знает
 // поэтому то что рядом есть ещё походая структура с такими же методами его нисколько не смущает
 
+// apigen:service {"prefix": "/v2"}
 type OtherApi struct {
 }
 
@@ -153,3 +201,112 @@ func (srv *OtherApi) Create(ctx context.Context, in OtherCreateParams) (*OtherUs
 		Level:    in.Level,
 	}, nil
 }
+
+// 3-я часть
+// правила валидации кроме required, paramname, enum, default, min и max
+
+type AdminApi struct {
+	mu sync.Mutex
+	// invited - кого пригласили, пишется middleware после вызова метода
+	invited []string
+	// middlewaresCalls - сколько раз строились middleware
+	middlewaresCalls int
+}
+
+func NewAdminApi() *AdminApi {
+	return &AdminApi{}
+}
+
+// Middlewares - первая middleware внешняя
+func (srv *AdminApi) Middlewares() []Middleware {
+	srv.mu.Lock()
+	srv.middlewaresCalls++
+	srv.mu.Unlock()
+
+	return []Middleware{
+		func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request, endpoint *Endpoint) {
+				w.Header().Add("X-Middleware", "outer")
+				next(w, r, endpoint)
+			}
+		},
+		func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request, endpoint *Endpoint) {
+				w.Header().Add("X-Middleware", "inner")
+				next(w, r, endpoint)
+				// параметры видны только после вызова next
+				if in, ok := endpoint.Params.(*InviteParams); ok {
+					srv.mu.Lock()
+					srv.invited = append(srv.invited, in.Email)
+					srv.mu.Unlock()
+				}
+			}
+		},
+	}
+}
+
+type InviteParams struct {
+	Email string `apivalidator:"required,email"`
+	Site  string `apivalidator:"url"`
+	Token string `apivalidator:"uuid"`
+	Role  string `apivalidator:"oneof=user moderator,default=user"`
+	Team  string `apivalidator:"required_if=Role moderator"`
+	Code  string `apivalidator:"len=6"`
+	From  int    `apivalidator:"min=0"`
+	Till  int    `apivalidator:"gtefield=From"`
+	Nick  string `apivalidator:"max=16,pattern=^[a-z][a-z0-9_]*$"`
+}
+
+type Invite struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	Team  string `json:"team"`
+	Nick  string `json:"nick"`
+}
+
+// apigen:api {"url": "/admin/invite", "method": "POST"}
+func (srv *AdminApi) Invite(ctx context.Context, in InviteParams) (*Invite, error) {
+	return &Invite{
+		Email: in.Email,
+		Role:  in.Role,
+		Team:  in.Team,
+		Nick:  in.Nick,
+	}, nil
+}
+
+// все нарушения правил, а не только первое
+// apigen:api {"url": "/admin/invite/check", "method": "POST", "errors": "all"}
+func (srv *AdminApi) CheckInvite(ctx context.Context, in InviteParams) (*Invite, error) {
+	return srv.Invite(ctx, in)
+}
+
+type PanicParams struct {
+}
+
+// паника в методе отвечает 500 и не роняет сервер
+// apigen:api {"url": "/admin/panic"}
+func (srv *AdminApi) Panic(ctx context.Context, in PanicParams) (*Invite, error) {
+	panic("admin panic")
+}
+
+type ReportParams struct {
+	Delay int `apivalidator:"min=0"`
+}
+
+type Report struct {
+	Invited int `json:"invited"`
+}
+
+// лимит считается по X-Auth уже после проверки авторизации
+// apigen:api {"url": "/admin/report", "auth": true, "rate": "2/m", "rate_key": "auth", "timeout": "50ms"}
+func (srv *AdminApi) Report(ctx context.Context, in ReportParams) (*Report, error) {
+	select {
+	case <-time.After(time.Duration(in.Delay) * time.Millisecond):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return &Report{Invited: len(srv.invited)}, nil
+}
@@ -1,40 +1,183 @@
 // go build gen/* && ./codegen.exe pack/unpack.go  pack/marshaller.go
-// go run pack/*
+// go run pack/unpack.go pack/marshaller.go
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"log"
 	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 )
 
-type tpl struct {
-	FieldName string
-}
+var headerTpl = template.Must(template.New("headerTpl").Parse(`// Code generated by codegen from {{.Source}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
 
+// errors of the generated methods, Unpack reports short input
+// as io.ErrUnexpectedEOF
 var (
-	intTpl = template.Must(template.New("intTpl").Parse(`
-	// {{.FieldName}}
-	var {{.FieldName}}Raw uint32
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}Raw)
-	in.{{.FieldName}} = int({{.FieldName}}Raw)
+	errBinpackRange    = errors.New("value out of range")
+	errBinpackTooLong  = errors.New("length exceeds max")
+	errBinpackTrailing = errors.New("trailing bytes")
+)
+
+// binpackChunk bounds the growth of the scratch buffer per read and
+// the buffers kept in the pool
+const binpackChunk = 64 << 10
+
+// binpackScratch is the buffer of UnpackFrom and PackTo, pooled so that
+// a stream of records is read and written without allocating
+type binpackScratch struct {
+	buf []byte
+	n   int // bytes of the record read so far
+}
+
+var binpackScratchPool = sync.Pool{
+	New: func() interface{} { return new(binpackScratch) },
+}
+
+// read returns the next n bytes of r, valid until the next read. The
+// buffer grows with the bytes actually read, so a crafted length can't
+// make it allocate more than the stream holds. A stream ending before
+// the record is io.EOF, within it io.ErrUnexpectedEOF
+func (s *binpackScratch) read(r io.Reader, n uint64) ([]byte, error) {
+	s.buf = s.buf[:0]
+	for uint64(len(s.buf)) < n {
+		chunk := n - uint64(len(s.buf))
+		if chunk > binpackChunk {
+			chunk = binpackChunk
+		}
+		start := len(s.buf)
+		s.buf = append(s.buf, make([]byte, chunk)...)
+		k, err := io.ReadFull(r, s.buf[start:])
+		s.n += k
+		if err == io.EOF && s.n != 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.buf, nil
+}
 `))
 
-	strTpl = template.Must(template.New("strTpl").Parse(`
-	// {{.FieldName}}
-	var {{.FieldName}}LenRaw uint32
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}LenRaw)
-	{{.FieldName}}Raw := make([]byte, {{.FieldName}}LenRaw)
-	binary.Read(r, binary.LittleEndian, &{{.FieldName}}Raw)
-	in.{{.FieldName}} = string({{.FieldName}}Raw)
+var methodsTpl = template.Must(template.New("methodsTpl").Parse(`
+func (in *{{.Name}}) Pack() ([]byte, error) {
+	return in.AppendPack(nil)
+}
+
+func (in *{{.Name}}) Unpack(data []byte) error {
+	rest, err := in.unpackBinpack(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("{{.Name}}: %w: %d", errBinpackTrailing, len(rest))
+	}
+	return nil
+}
+
+// PackTo writes the packed {{.Name}} to w in a single Write
+func (in *{{.Name}}) PackTo(w io.Writer) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	buf, err := in.AppendPack(s.buf[:0])
+	if err != nil {
+		return err
+	}
+	if cap(buf) <= binpackChunk {
+		s.buf = buf
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// UnpackFrom reads one {{.Name}} from r and nothing past it, io.EOF
+// means r ended before the record. The slices and strings of in are
+// reused when they can be, so reading a stream into the same value
+// doesn't allocate
+func (in *{{.Name}}) UnpackFrom(r io.Reader) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	s.n = 0
+	return in.unpackBinpackFrom(r, s)
+}
+
+// AppendPack appends the packed {{.Name}} to buf
+func (in *{{.Name}}) AppendPack(buf []byte) ([]byte, error) {
+{{- .Pack}}
+	return buf, nil
+}
+
+func (in *{{.Name}}) unpackBinpack(data []byte) ([]byte, error) {
+{{- .Unpack}}
+	return data, nil
+}
+
+func (in *{{.Name}}) unpackBinpackFrom(r io.Reader, s *binpackScratch) error {
+{{- if .Reads}}
+	var (
+		b   []byte
+		err error
+	)
+{{end}}
+{{- .From}}
+	return nil
+}
 `))
-)
+
+// fixedInts are the sizes of the integer types, int and uint are
+// written as 32 bits like the first version of the format did
+var fixedInts = map[string]int{
+	"int8": 1, "uint8": 1, "byte": 1,
+	"int16": 2, "uint16": 2,
+	"int32": 4, "uint32": 4, "rune": 4, "int": 4, "uint": 4,
+	"int64": 8, "uint64": 8,
+}
+
+// lenPrefixes are the lenprefix options with their size in bytes
+var lenPrefixes = map[string]int{"u8": 1, "u16": 2, "u32": 4, "u64": 8}
+
+// binpackStruct is a struct marked with cgen: binpack
+type binpackStruct struct {
+	Name      string
+	Type      *ast.StructType
+	Endian    string
+	LenPrefix string
+}
+
+// gen writes the code of one struct, pack, unpack and from hold the
+// bodies of its AppendPack, unpackBinpack and unpackBinpackFrom methods
+type gen struct {
+	structs map[string]*binpackStruct
+	imports map[string]bool
+	order   string
+	prefix  string
+	pack    *bytes.Buffer
+	unpack  *bytes.Buffer
+	from    *bytes.Buffer
+	reads   bool
+	vars    int
+	depth   int
+}
 
 func main() {
 	fset := token.NewFileSet()
@@ -43,13 +186,8 @@ func main() {
 		log.Fatal(err)
 	}
 
-	out, _ := os.Create(os.Args[2])
-
-	fmt.Fprintln(out, `package `+node.Name.Name)
-	fmt.Fprintln(out) // empty line
-	fmt.Fprintln(out, `import "encoding/binary"`)
-	fmt.Fprintln(out, `import "bytes"`)
-	fmt.Fprintln(out) // empty line
+	var structs []*binpackStruct
+	byName := make(map[string]*binpackStruct)
 
 	for _, f := range node.Decls {
 		g, ok := f.(*ast.GenDecl)
@@ -76,53 +214,425 @@ func main() {
 				continue
 			}
 
-			needCodegen := false
+			var mark *ast.Comment
 			for _, comment := range g.Doc.List {
-				needCodegen = needCodegen || strings.HasPrefix(comment.Text, "// cgen: binpack")
+				if strings.HasPrefix(comment.Text, "// cgen: binpack") {
+					mark = comment
+				}
 			}
-			if !needCodegen {
+			if mark == nil {
 				fmt.Printf("SKIP struct %#v doesnt have cgen mark\n", currType.Name.Name)
 				continue SPECS_LOOP
 			}
 
-			fmt.Printf("process struct %s\n", currType.Name.Name)
-			fmt.Printf("\tgenerating Unpack method\n")
+			s := &binpackStruct{
+				Name:      currType.Name.Name,
+				Type:      currStruct,
+				Endian:    "little",
+				LenPrefix: "u32",
+			}
+			parseOptions(s, strings.TrimPrefix(mark.Text, "// cgen: binpack"))
+			structs = append(structs, s)
+			byName[s.Name] = s
+		}
+	}
 
-			fmt.Fprintln(out, "func (in *"+currType.Name.Name+") Unpack(data []byte) error {")
-			fmt.Fprintln(out, "	r := bytes.NewReader(data)")
+	out := &bytes.Buffer{}
+	imports := map[string]bool{"errors": true, "fmt": true, "io": true, "sync": true}
 
-		FIELDS_LOOP:
-			for _, field := range currStruct.Fields.List {
+	for _, s := range structs {
+		fmt.Printf("process struct %s\n", s.Name)
+		fmt.Printf("\tgenerating Pack, Unpack and streaming methods\n")
 
-				if field.Tag != nil {
-					tag := reflect.StructTag(field.Tag.Value[1 : len(field.Tag.Value)-1])
-					if tag.Get("cgen") == "-" {
-						continue FIELDS_LOOP
-					}
+		g := &gen{
+			structs: byName,
+			imports: imports,
+			order:   "binary.LittleEndian",
+			prefix:  s.LenPrefix,
+			pack:    &bytes.Buffer{},
+			unpack:  &bytes.Buffer{},
+			from:    &bytes.Buffer{},
+		}
+		if s.Endian == "big" {
+			g.order = "binary.BigEndian"
+		}
+
+	FIELDS_LOOP:
+		for _, field := range s.Type.Fields.List {
+			max := 0
+
+			if field.Tag != nil {
+				tag := reflect.StructTag(field.Tag.Value[1 : len(field.Tag.Value)-1])
+				if tag.Get("cgen") == "-" {
+					continue FIELDS_LOOP
 				}
+				max = parseMax(tag.Get("cgen"))
+			}
+
+			if len(field.Names) == 0 {
+				log.Fatalln("unsupported embedded field in", s.Name)
+			}
+			for _, name := range field.Names {
+				fmt.Printf("\tgenerating code for field %s.%s\n", s.Name, name.Name)
 
-				fieldName := field.Names[0].Name
-				fileType := field.Type.(*ast.Ident).Name
+				fmt.Fprintf(g.pack, "\n\t// %s\n", name.Name)
+				fmt.Fprintf(g.unpack, "\n\t// %s\n", name.Name)
+				fmt.Fprintf(g.from, "\n\t// %s\n", name.Name)
+				g.field("in."+name.Name, field.Type, max, s.Name+"."+name.Name)
+			}
+		}
 
-				fmt.Printf("\tgenerating code for field %s.%s\n", currType.Name.Name, fieldName)
+		methodsTpl.Execute(out, struct {
+			Name, Pack, Unpack, From string
+			Reads                    bool
+		}{s.Name, g.pack.String(), g.unpack.String(), g.from.String(), g.reads})
+	}
 
-				switch fileType {
-				case "int":
-					intTpl.Execute(out, tpl{fieldName})
-				case "string":
-					strTpl.Execute(out, tpl{fieldName})
-				default:
-					log.Fatalln("unsupported", fileType)
-				}
+	header := &bytes.Buffer{}
+	headerTpl.Execute(header, struct {
+		Source, Package string
+		Imports         []string
+	}{os.Args[1], node.Name.Name, sortedKeys(imports)})
+
+	src, err := format.Source(append(header.Bytes(), out.Bytes()...))
+	if err != nil {
+		log.Fatalln("generated code is invalid:", err)
+	}
+	if err := os.WriteFile(os.Args[2], src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newVar returns a unique name for the temporaries of the generated code
+func (g *gen) newVar(name string) string {
+	g.vars++
+	return name + strconv.Itoa(g.vars)
+}
+
+// need writes the check of the remaining data before reading size bytes
+func (g *gen) need(size int) {
+	g.imports["io"] = true
+	fmt.Fprintf(g.unpack, "\tif len(data) < %d {\n\t\treturn nil, io.ErrUnexpectedEOF\n\t}\n", size)
+}
+
+// read writes the unpacking of size bytes from the data and from the
+// stream, decode returns the statements for the bytes named src and
+// the values returned before an error, ret
+func (g *gen) read(size int, decode func(src, ret string) string) {
+	g.need(size)
+	fmt.Fprintf(g.unpack, "%s\tdata = data[%d:]\n", decode("data", "nil, "), size)
+	g.readFrom(strconv.Itoa(size))
+	fmt.Fprint(g.from, decode("b", ""))
+}
+
+// readFrom writes the read of n bytes of the stream into b
+func (g *gen) readFrom(n string) {
+	g.reads = true
+	fmt.Fprintf(g.from, "\tif b, err = s.read(r, %s); err != nil {\n\t\treturn err\n\t}\n", n)
+}
+
+// field writes the code packing and unpacking the expression of type typ,
+// max limits the length of strings and slices
+func (g *gen) field(expr string, typ ast.Expr, max int, path string) {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		if max != 0 && t.Name != "string" {
+			log.Fatalln("max is only supported for strings and slices,", path)
+		}
+		g.ident(expr, t.Name, max, path)
+
+	case *ast.ArrayType:
+		elem, isByte := t.Elt.(*ast.Ident)
+		isByte = isByte && (elem.Name == "byte" || elem.Name == "uint8")
+
+		if t.Len == nil {
+			g.slice(expr, t.Elt, isByte, max, path)
+			return
+		}
+
+		if max != 0 {
+			log.Fatalln("max is only supported for strings and slices,", path)
+		}
+		if isByte {
+			fmt.Fprintf(g.pack, "\tbuf = append(buf, %s[:]...)\n", expr)
+			g.read(arrayLen(t, path), func(src, ret string) string {
+				return fmt.Sprintf("\tcopy(%s[:], %s)\n", expr, src)
+			})
+			return
+		}
+		g.loop(expr, t.Elt, path, "")
+
+	default:
+		log.Fatalln("unsupported type of", path)
+	}
+}
+
+// ident writes the code of the basic types and the nested binpack structs
+func (g *gen) ident(expr, name string, max int, path string) {
+	if size, ok := fixedInts[name]; ok {
+		g.integer(expr, name, size, path)
+		return
+	}
+
+	switch name {
+	case "bool":
+		fmt.Fprintf(g.pack, "\tif %s {\n\t\tbuf = append(buf, 1)\n\t} else {\n\t\tbuf = append(buf, 0)\n\t}\n", expr)
+		g.read(1, func(src, ret string) string {
+			return fmt.Sprintf("\tswitch %[2]s[0] {\n\tcase 0:\n\t\t%[1]s = false\n\tcase 1:\n\t\t%[1]s = true\n", expr, src) +
+				fmt.Sprintf("\tdefault:\n\t\treturn %sfmt.Errorf(\"%s: %%w: bool %%d\", errBinpackRange, %s[0])\n\t}\n", ret, path, src)
+		})
+
+	case "float32", "float64":
+		size, bits := 4, "32"
+		if name == "float64" {
+			size, bits = 8, "64"
+		}
+		g.imports["encoding/binary"] = true
+		g.imports["math"] = true
+		fmt.Fprintf(g.pack, "\tbuf = %s.AppendUint%s(buf, math.Float%sbits(%s))\n", g.order, bits, bits, expr)
+		g.read(size, func(src, ret string) string {
+			return fmt.Sprintf("\t%s = math.Float%sfrombits(%s.Uint%s(%s))\n", expr, bits, g.order, bits, src)
+		})
+
+	case "string":
+		n := g.length(expr, max, path, 1)
+		fmt.Fprintf(g.pack, "\tbuf = append(buf, %s...)\n", expr)
+		fmt.Fprintf(g.unpack, "\t%s = string(data[:%s])\n\tdata = data[%s:]\n", expr, n, n)
+		// the comparison doesn't allocate, an unchanged string is kept
+		g.readFrom(n)
+		fmt.Fprintf(g.from, "\tif string(b) != %[1]s {\n\t\t%[1]s = string(b)\n\t}\n", expr)
+
+	default:
+		if _, ok := g.structs[name]; !ok {
+			log.Fatalln("unsupported type", name, "of", path+", only structs marked with cgen: binpack can be nested")
+		}
+		b, rest, err := g.newVar("b"), g.newVar("rest"), g.newVar("err")
+		fmt.Fprintf(g.pack, "\t%s, %s := %s.AppendPack(buf)\n\tif %s != nil {\n\t\treturn nil, %s\n\t}\n\tbuf = %s\n", b, err, expr, err, err, b)
+		fmt.Fprintf(g.unpack, "\t%s, %s := %s.unpackBinpack(data)\n\tif %s != nil {\n\t\treturn nil, %s\n\t}\n\tdata = %s\n", rest, err, expr, err, err, rest)
+		fmt.Fprintf(g.from, "\tif %s := %s.unpackBinpackFrom(r, s); %s != nil {\n\t\treturn %s\n\t}\n", err, expr, err, err)
+	}
+}
+
+// integer writes the fixed size integers, int and uint are range checked
+func (g *gen) integer(expr, name string, size int, path string) {
+	if size == 1 {
+		fmt.Fprintf(g.pack, "\tbuf = append(buf, byte(%s))\n", expr)
+		g.read(1, func(src, ret string) string {
+			return fmt.Sprintf("\t%s = %s(%s[0])\n", expr, name, src)
+		})
+		return
+	}
+
+	g.imports["encoding/binary"] = true
+	bits := strconv.Itoa(size * 8)
+	switch name {
+	case "int":
+		g.imports["math"] = true
+		fmt.Fprintf(g.pack, "\tif %[1]s < 0 || uint64(%[1]s) > math.MaxUint32 {\n", expr)
+		fmt.Fprintf(g.pack, "\t\treturn nil, fmt.Errorf(\"%s: %%w: %%d\", errBinpackRange, %s)\n\t}\n", path, expr)
+	case "uint":
+		g.imports["math"] = true
+		fmt.Fprintf(g.pack, "\tif uint64(%s) > math.MaxUint32 {\n", expr)
+		fmt.Fprintf(g.pack, "\t\treturn nil, fmt.Errorf(\"%s: %%w: %%d\", errBinpackRange, %s)\n\t}\n", path, expr)
+	}
+	fmt.Fprintf(g.pack, "\tbuf = %s.AppendUint%s(buf, uint%s(%s))\n", g.order, bits, bits, expr)
+	g.read(size, func(src, ret string) string {
+		return fmt.Sprintf("\t%s = %s(%s.Uint%s(%s))\n", expr, name, g.order, bits, src)
+	})
+}
+
+// length writes the length prefix of a string or slice and the checks of
+// its value, the name of the unpacked length is returned. At least elemSize
+// bytes must remain for every element, so that a crafted length can't make
+// Unpack allocate more than the size of the data
+func (g *gen) length(expr string, max int, path string, elemSize int) string {
+	size := lenPrefixes[g.prefix]
+	bits := strconv.Itoa(size * 8)
+
+	limit := ""
+	switch {
+	case max != 0:
+		if size < 8 && uint64(max) >= 1<<uint(size*8) {
+			log.Fatalln("max of", path, "doesn't fit lenprefix", g.prefix)
+		}
+		limit = strconv.Itoa(max)
+	case size < 8:
+		g.imports["math"] = true
+		limit = "math.MaxUint" + bits
+	}
+	if limit != "" {
+		fmt.Fprintf(g.pack, "\tif uint64(len(%s)) > %s {\n", expr, limit)
+		fmt.Fprintf(g.pack, "\t\treturn nil, fmt.Errorf(\"%s: %%w: %%d > %%d\", errBinpackTooLong, len(%s), uint64(%s))\n\t}\n", path, expr, limit)
+	}
+
+	n := g.newVar("n")
+	if size == 1 {
+		fmt.Fprintf(g.pack, "\tbuf = append(buf, byte(len(%s)))\n", expr)
+		g.read(1, func(src, ret string) string {
+			return fmt.Sprintf("\t%s := uint64(%s[0])\n", n, src)
+		})
+	} else {
+		g.imports["encoding/binary"] = true
+		fmt.Fprintf(g.pack, "\tbuf = %s.AppendUint%s(buf, uint%s(len(%s)))\n", g.order, bits, bits, expr)
+		g.read(size, func(src, ret string) string {
+			return fmt.Sprintf("\t%s := uint64(%s.Uint%s(%s))\n", n, g.order, bits, src)
+		})
+	}
+
+	if max != 0 {
+		for _, out := range []struct {
+			buf *bytes.Buffer
+			ret string
+		}{{g.unpack, "nil, "}, {g.from, ""}} {
+			fmt.Fprintf(out.buf, "\tif %s > %d {\n", n, max)
+			fmt.Fprintf(out.buf, "\t\treturn %sfmt.Errorf(\"%s: %%w: %%d > %d\", errBinpackTooLong, %s)\n\t}\n", out.ret, path, max, n)
+		}
+	}
+	fmt.Fprintf(g.unpack, "\tif %s > uint64(len(data)/%d) {\n\t\treturn nil, io.ErrUnexpectedEOF\n\t}\n", n, elemSize)
+	return n
+}
+
+// slice writes the length prefixed slices, []byte is copied at once
+func (g *gen) slice(expr string, elem ast.Expr, isByte bool, max int, path string) {
+	size := g.minSize(elem, path)
+	if size == 0 {
+		log.Fatalln("unsupported zero size elements of", path)
+	}
+
+	n := g.length(expr, max, path, size)
+	if isByte {
+		fmt.Fprintf(g.pack, "\tbuf = append(buf, %s...)\n", expr)
+		fmt.Fprintf(g.unpack, "\t%s = append(%s[:0:0], data[:%s]...)\n\tdata = data[%s:]\n", expr, expr, n, n)
+		g.readFrom(n)
+		fmt.Fprintf(g.from, "\t%[1]s = append(%[1]s[:0], b...)\n", expr)
+		return
+	}
+
+	fmt.Fprintf(g.unpack, "\t%s = make(%s, %s)\n", expr, typeString(&ast.ArrayType{Elt: elem}), n)
+	g.loop(expr, elem, path, n)
+}
+
+// loop writes the code of every element of an array or slice, n names the
+// length of a slice. Read from a stream, a slice grows with the elements
+// read and reuses the ones of the earlier records
+func (g *gen) loop(expr string, elem ast.Expr, path, n string) {
+	i := "i" + strconv.Itoa(g.depth)
+	g.depth++
+	defer func() { g.depth-- }()
+
+	fmt.Fprintf(g.pack, "\tfor %s := range %s {\n", i, expr)
+	fmt.Fprintf(g.unpack, "\tfor %s := range %s {\n", i, expr)
+	if n == "" {
+		fmt.Fprintf(g.from, "\tfor %s := range %s {\n", i, expr)
+	} else {
+		fmt.Fprintf(g.from, "\t%[2]s = %[2]s[:0]\n\tfor %[1]s := uint64(0); %[1]s < %[3]s; %[1]s++ {\n", i, expr, n)
+		fmt.Fprintf(g.from, "\t\tif %[1]s < uint64(cap(%[2]s)) {\n\t\t\t%[2]s = %[2]s[:%[1]s+1]\n", i, expr)
+		fmt.Fprintf(g.from, "\t\t} else {\n\t\t\t%s = append(%s, *new(%s))\n\t\t}\n", expr, expr, typeString(elem))
+	}
+	g.field(expr+"["+i+"]", elem, 0, path)
+	fmt.Fprintf(g.pack, "\t}\n")
+	fmt.Fprintf(g.unpack, "\t}\n")
+	fmt.Fprintf(g.from, "\t}\n")
+}
+
+// minSize returns the smallest number of bytes a value of the type takes
+func (g *gen) minSize(typ ast.Expr, path string) int {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		if size, ok := fixedInts[t.Name]; ok {
+			return size
+		}
+		switch t.Name {
+		case "bool":
+			return 1
+		case "float32":
+			return 4
+		case "float64":
+			return 8
+		case "string":
+			return lenPrefixes[g.prefix]
+		}
+
+		s, ok := g.structs[t.Name]
+		if !ok {
+			log.Fatalln("unsupported type", t.Name, "of", path)
+		}
+		nested := &gen{structs: g.structs, prefix: s.LenPrefix}
+		size := 0
+		for _, field := range s.Type.Fields.List {
+			if field.Tag != nil && reflect.StructTag(field.Tag.Value[1:len(field.Tag.Value)-1]).Get("cgen") == "-" {
+				continue
 			}
+			size += len(field.Names) * nested.minSize(field.Type, path)
+		}
+		return size
 
-			fmt.Fprintln(out, "	return nil")
-			fmt.Fprintln(out, "}") // end of Unpack func
-			fmt.Fprintln(out)      // empty line
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return lenPrefixes[g.prefix]
+		}
+		return arrayLen(t, path) * g.minSize(t.Elt, path)
+	}
 
+	log.Fatalln("unsupported type of", path)
+	return 0
+}
+
+// arrayLen returns the length of a fixed size array, written as a number
+func arrayLen(t *ast.ArrayType, path string) int {
+	lit, ok := t.Len.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		log.Fatalln("unsupported array length of", path)
+	}
+	n, err := strconv.ParseInt(lit.Value, 0, 64)
+	if err != nil {
+		log.Fatalln("unsupported array length of", path)
+	}
+	return int(n)
+}
+
+func typeString(typ ast.Expr) string {
+	buf := &bytes.Buffer{}
+	format.Node(buf, token.NewFileSet(), typ)
+	return buf.String()
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseOptions reads the options following the cgen: binpack mark,
+// like endian=big lenprefix=u16
+func parseOptions(s *binpackStruct, text string) {
+	for _, option := range strings.Fields(text) {
+		name, value, _ := strings.Cut(option, "=")
+		switch {
+		case name == "endian" && (value == "little" || value == "big"):
+			s.Endian = value
+		case name == "lenprefix" && lenPrefixes[value] != 0:
+			s.LenPrefix = value
+		default:
+			log.Fatalln("bad cgen option", option, "of", s.Name+", want endian=little|big and lenprefix=u8|u16|u32|u64")
 		}
 	}
 }
 
-// go build gen/* && ./codegen.exe pack/unpack.go  pack/marshaller.go
-// go run pack/*
+// parseMax reads the max=N option of a cgen tag
+func parseMax(tag string) int {
+	for _, option := range strings.Split(tag, ",") {
+		if !strings.HasPrefix(option, "max=") {
+			continue
+		}
+		max, err := strconv.Atoi(strings.TrimPrefix(option, "max="))
+		if err != nil || max <= 0 {
+			log.Fatalln("bad cgen option", option)
+		}
+		return max
+	}
+	return 0
+}
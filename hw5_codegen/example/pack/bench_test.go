@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// records is the number of users in the benchmarked stream
+const records = 1000
+
+var benchUser = User{ID: 1123456, Login: "v.romanov", Flags: 16}
+
+// unpackReflect reads a user field by field with encoding/binary,
+// like the code generated before Unpack
+func unpackReflect(r io.Reader, u *User) error {
+	var id, loginLen, flags uint32
+	if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &loginLen); err != nil {
+		return err
+	}
+	login := make([]byte, loginLen)
+	if err := binary.Read(r, binary.LittleEndian, &login); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &flags); err != nil {
+		return err
+	}
+	u.ID, u.Login, u.Flags = int(id), string(login), int(flags)
+	return nil
+}
+
+// packReflect is the encoding/binary counterpart of PackTo
+func packReflect(w io.Writer, u *User) error {
+	for _, v := range []interface{}{uint32(u.ID), uint32(len(u.Login)), []byte(u.Login), uint32(u.Flags)} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stream(tb testing.TB) []byte {
+	buf := &bytes.Buffer{}
+	for i := 0; i < records; i++ {
+		if err := benchUser.PackTo(buf); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestUnpackFromAllocs(t *testing.T) {
+	data := stream(t)
+	r := bytes.NewReader(data)
+	u := User{}
+
+	// AllocsPerRun calls the func once more to warm up
+	allocs := testing.AllocsPerRun(records-1, func() {
+		if err := u.UnpackFrom(r); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("UnpackFrom allocates %v times per record", allocs)
+	}
+	if u != benchUser {
+		t.Errorf("unpacked %#v", u)
+	}
+}
+
+func BenchmarkUnpack(b *testing.B) {
+	data, _ := benchUser.Pack()
+	u := User{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := u.Unpack(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnpackFrom(b *testing.B) {
+	data := stream(b)
+	r := bytes.NewReader(data)
+	u := User{}
+	b.SetBytes(int64(len(data) / records))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := u.UnpackFrom(r); err == io.EOF {
+			r.Reset(data)
+		} else if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnpackReflect(b *testing.B) {
+	data := stream(b)
+	r := bytes.NewReader(data)
+	u := User{}
+	b.SetBytes(int64(len(data) / records))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := unpackReflect(r, &u); err == io.EOF {
+			r.Reset(data)
+		} else if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPack(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := benchUser.Pack(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendPack(b *testing.B) {
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = benchUser.AppendPack(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPackTo(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := benchUser.PackTo(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPackReflect(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := packReflect(io.Discard, &benchUser); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
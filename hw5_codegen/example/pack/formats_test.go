@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// binpacker is implemented by the generated methods of every struct
+type binpacker interface {
+	Pack() ([]byte, error)
+	Unpack([]byte) error
+	UnpackFrom(io.Reader) error
+}
+
+func TestFormats(t *testing.T) {
+	cases := []struct {
+		name   string
+		value  binpacker
+		empty  func() binpacker
+		packed []byte
+	}{
+		{
+			name:  "big endian",
+			value: &Header{Version: 2, Length: 0x01020304, Seq: -2, Ratio: 1.5, Name: "hi", Ports: []uint16{80, 443}},
+			empty: func() binpacker { return &Header{} },
+			packed: join(
+				[]byte{0, 2},
+				[]byte{1, 2, 3, 4},
+				[]byte{255, 255, 255, 255, 255, 255, 255, 254},
+				[]byte{63, 192, 0, 0},
+				[]byte{0, 0, 0, 2}, []byte("hi"),
+				[]byte{0, 0, 0, 2}, []byte{0, 80, 1, 187},
+			),
+		},
+		{
+			name:   "u8 length prefix",
+			value:  &ShortFrame{Tag: "ab", Data: []byte{1, 2, 3}},
+			empty:  func() binpacker { return &ShortFrame{} },
+			packed: join([]byte{2}, []byte("ab"), []byte{3, 1, 2, 3}),
+		},
+		{
+			name:  "u16 length prefix",
+			value: &Frame{Tag: "ab", IDs: []int32{1, -1}},
+			empty: func() binpacker { return &Frame{} },
+			packed: join(
+				[]byte{2, 0}, []byte("ab"),
+				[]byte{2, 0}, []byte{1, 0, 0, 0, 255, 255, 255, 255},
+			),
+		},
+		{
+			name:   "u64 length prefix",
+			value:  &LongFrame{Data: []byte{7}},
+			empty:  func() binpacker { return &LongFrame{} },
+			packed: []byte{1, 0, 0, 0, 0, 0, 0, 0, 7},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			packed, err := tc.value.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(packed, tc.packed) {
+				t.Errorf("packed %v, want %v", packed, tc.packed)
+			}
+
+			got := tc.empty()
+			if err := got.Unpack(tc.packed); err != nil || !reflect.DeepEqual(got, tc.value) {
+				t.Errorf("unpacked %#v, %v", got, err)
+			}
+			got = tc.empty()
+			if err := got.UnpackFrom(bytes.NewReader(tc.packed)); err != nil || !reflect.DeepEqual(got, tc.value) {
+				t.Errorf("read %#v, %v", got, err)
+			}
+			if err := tc.empty().Unpack(tc.packed[:len(tc.packed)-1]); err != io.ErrUnexpectedEOF {
+				t.Errorf("truncated: got %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatLimits(t *testing.T) {
+	packs := []struct {
+		name  string
+		value binpacker
+		err   error
+	}{
+		{"big endian name at max", &Header{Name: strings.Repeat("a", 16)}, nil},
+		{"big endian name over max", &Header{Name: strings.Repeat("a", 17)}, errBinpackTooLong},
+		{"u8 string at limit", &ShortFrame{Tag: strings.Repeat("a", 255)}, nil},
+		{"u8 string over limit", &ShortFrame{Tag: strings.Repeat("a", 256)}, errBinpackTooLong},
+		{"u8 bytes over limit", &ShortFrame{Data: make([]byte, 256)}, errBinpackTooLong},
+		{"u16 string at limit", &Frame{Tag: strings.Repeat("a", 65535)}, nil},
+		{"u16 string over limit", &Frame{Tag: strings.Repeat("a", 65536)}, errBinpackTooLong},
+		{"u16 slice over limit", &Frame{IDs: make([]int32, 65536)}, errBinpackTooLong},
+		{"u64 has no limit", &LongFrame{Data: make([]byte, 65536)}, nil},
+	}
+	for _, tc := range packs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.value.Pack(); !errors.Is(err, tc.err) {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+
+	// lengths past the data are rejected before anything is allocated
+	unpacks := []struct {
+		name  string
+		empty binpacker
+		data  []byte
+		err   error
+	}{
+		{"big endian name over max", &Header{}, join(make([]byte, 18), []byte{0, 0, 0, 17}, []byte(strings.Repeat("a", 17))), errBinpackTooLong},
+		{"big endian huge ports length", &Header{}, join(make([]byte, 18), []byte{0, 0, 0, 0}, []byte{255, 255, 255, 255}), io.ErrUnexpectedEOF},
+		{"u8 length past the data", &ShortFrame{}, []byte{255, 'a'}, io.ErrUnexpectedEOF},
+		{"u16 length past the data", &Frame{}, []byte{0, 0, 255, 255, 1, 0, 0, 0}, io.ErrUnexpectedEOF},
+		{"u64 huge length", &LongFrame{}, []byte{0, 0, 0, 0, 0, 0, 0, 128, 7}, io.ErrUnexpectedEOF},
+	}
+	for _, tc := range unpacks {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.empty.Unpack(tc.data); !errors.Is(err, tc.err) {
+				t.Errorf("Unpack: got %v, want %v", err, tc.err)
+			}
+			if err := tc.empty.UnpackFrom(bytes.NewReader(tc.data)); !errors.Is(err, tc.err) {
+				t.Errorf("UnpackFrom: got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
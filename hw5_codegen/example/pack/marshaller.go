@@ -1,26 +1,748 @@
+// Code generated by codegen from pack/unpack.go; DO NOT EDIT.
+
 package main
 
-import "encoding/binary"
-import "bytes"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// errors of the generated methods, Unpack reports short input
+// as io.ErrUnexpectedEOF
+var (
+	errBinpackRange    = errors.New("value out of range")
+	errBinpackTooLong  = errors.New("length exceeds max")
+	errBinpackTrailing = errors.New("trailing bytes")
+)
+
+// binpackChunk bounds the growth of the scratch buffer per read and
+// the buffers kept in the pool
+const binpackChunk = 64 << 10
+
+// binpackScratch is the buffer of UnpackFrom and PackTo, pooled so that
+// a stream of records is read and written without allocating
+type binpackScratch struct {
+	buf []byte
+	n   int // bytes of the record read so far
+}
+
+var binpackScratchPool = sync.Pool{
+	New: func() interface{} { return new(binpackScratch) },
+}
+
+// read returns the next n bytes of r, valid until the next read. The
+// buffer grows with the bytes actually read, so a crafted length can't
+// make it allocate more than the stream holds. A stream ending before
+// the record is io.EOF, within it io.ErrUnexpectedEOF
+func (s *binpackScratch) read(r io.Reader, n uint64) ([]byte, error) {
+	s.buf = s.buf[:0]
+	for uint64(len(s.buf)) < n {
+		chunk := n - uint64(len(s.buf))
+		if chunk > binpackChunk {
+			chunk = binpackChunk
+		}
+		start := len(s.buf)
+		s.buf = append(s.buf, make([]byte, chunk)...)
+		k, err := io.ReadFull(r, s.buf[start:])
+		s.n += k
+		if err == io.EOF && s.n != 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.buf, nil
+}
+
+func (in *User) Pack() ([]byte, error) {
+	return in.AppendPack(nil)
+}
 
 func (in *User) Unpack(data []byte) error {
-	r := bytes.NewReader(data)
+	rest, err := in.unpackBinpack(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("User: %w: %d", errBinpackTrailing, len(rest))
+	}
+	return nil
+}
+
+// PackTo writes the packed User to w in a single Write
+func (in *User) PackTo(w io.Writer) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	buf, err := in.AppendPack(s.buf[:0])
+	if err != nil {
+		return err
+	}
+	if cap(buf) <= binpackChunk {
+		s.buf = buf
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// UnpackFrom reads one User from r and nothing past it, io.EOF
+// means r ended before the record. The slices and strings of in are
+// reused when they can be, so reading a stream into the same value
+// doesn't allocate
+func (in *User) UnpackFrom(r io.Reader) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	s.n = 0
+	return in.unpackBinpackFrom(r, s)
+}
 
+// AppendPack appends the packed User to buf
+func (in *User) AppendPack(buf []byte) ([]byte, error) {
 	// ID
-	var IDRaw uint32
-	binary.Read(r, binary.LittleEndian, &IDRaw)
-	in.ID = int(IDRaw)
+	if in.ID < 0 || uint64(in.ID) > math.MaxUint32 {
+		return nil, fmt.Errorf("User.ID: %w: %d", errBinpackRange, in.ID)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(in.ID))
 
 	// Login
-	var LoginLenRaw uint32
-	binary.Read(r, binary.LittleEndian, &LoginLenRaw)
-	LoginRaw := make([]byte, LoginLenRaw)
-	binary.Read(r, binary.LittleEndian, &LoginRaw)
-	in.Login = string(LoginRaw)
+	if uint64(len(in.Login)) > 64 {
+		return nil, fmt.Errorf("User.Login: %w: %d > %d", errBinpackTooLong, len(in.Login), uint64(64))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(in.Login)))
+	buf = append(buf, in.Login...)
 
 	// Flags
-	var FlagsRaw uint32
-	binary.Read(r, binary.LittleEndian, &FlagsRaw)
-	in.Flags = int(FlagsRaw)
+	if in.Flags < 0 || uint64(in.Flags) > math.MaxUint32 {
+		return nil, fmt.Errorf("User.Flags: %w: %d", errBinpackRange, in.Flags)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(in.Flags))
+
+	return buf, nil
+}
+
+func (in *User) unpackBinpack(data []byte) ([]byte, error) {
+	// ID
+	if len(data) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.ID = int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+
+	// Login
+	if len(data) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n1 := uint64(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+	if n1 > 64 {
+		return nil, fmt.Errorf("User.Login: %w: %d > 64", errBinpackTooLong, n1)
+	}
+	if n1 > uint64(len(data)/1) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Login = string(data[:n1])
+	data = data[n1:]
+
+	// Flags
+	if len(data) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Flags = int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+
+	return data, nil
+}
+
+func (in *User) unpackBinpackFrom(r io.Reader, s *binpackScratch) error {
+	var (
+		b   []byte
+		err error
+	)
+
+	// ID
+	if b, err = s.read(r, 4); err != nil {
+		return err
+	}
+	in.ID = int(binary.LittleEndian.Uint32(b))
+
+	// Login
+	if b, err = s.read(r, 4); err != nil {
+		return err
+	}
+	n1 := uint64(binary.LittleEndian.Uint32(b))
+	if n1 > 64 {
+		return fmt.Errorf("User.Login: %w: %d > 64", errBinpackTooLong, n1)
+	}
+	if b, err = s.read(r, n1); err != nil {
+		return err
+	}
+	if string(b) != in.Login {
+		in.Login = string(b)
+	}
+
+	// Flags
+	if b, err = s.read(r, 4); err != nil {
+		return err
+	}
+	in.Flags = int(binary.LittleEndian.Uint32(b))
+
+	return nil
+}
+
+func (in *Header) Pack() ([]byte, error) {
+	return in.AppendPack(nil)
+}
+
+func (in *Header) Unpack(data []byte) error {
+	rest, err := in.unpackBinpack(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("Header: %w: %d", errBinpackTrailing, len(rest))
+	}
+	return nil
+}
+
+// PackTo writes the packed Header to w in a single Write
+func (in *Header) PackTo(w io.Writer) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	buf, err := in.AppendPack(s.buf[:0])
+	if err != nil {
+		return err
+	}
+	if cap(buf) <= binpackChunk {
+		s.buf = buf
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// UnpackFrom reads one Header from r and nothing past it, io.EOF
+// means r ended before the record. The slices and strings of in are
+// reused when they can be, so reading a stream into the same value
+// doesn't allocate
+func (in *Header) UnpackFrom(r io.Reader) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	s.n = 0
+	return in.unpackBinpackFrom(r, s)
+}
+
+// AppendPack appends the packed Header to buf
+func (in *Header) AppendPack(buf []byte) ([]byte, error) {
+	// Version
+	buf = binary.BigEndian.AppendUint16(buf, uint16(in.Version))
+
+	// Length
+	buf = binary.BigEndian.AppendUint32(buf, uint32(in.Length))
+
+	// Seq
+	buf = binary.BigEndian.AppendUint64(buf, uint64(in.Seq))
+
+	// Ratio
+	buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(in.Ratio))
+
+	// Name
+	if uint64(len(in.Name)) > 16 {
+		return nil, fmt.Errorf("Header.Name: %w: %d > %d", errBinpackTooLong, len(in.Name), uint64(16))
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(in.Name)))
+	buf = append(buf, in.Name...)
+
+	// Ports
+	if uint64(len(in.Ports)) > math.MaxUint32 {
+		return nil, fmt.Errorf("Header.Ports: %w: %d > %d", errBinpackTooLong, len(in.Ports), uint64(math.MaxUint32))
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(in.Ports)))
+	for i0 := range in.Ports {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(in.Ports[i0]))
+	}
+
+	return buf, nil
+}
+
+func (in *Header) unpackBinpack(data []byte) ([]byte, error) {
+	// Version
+	if len(data) < 2 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Version = uint16(binary.BigEndian.Uint16(data))
+	data = data[2:]
+
+	// Length
+	if len(data) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Length = uint32(binary.BigEndian.Uint32(data))
+	data = data[4:]
+
+	// Seq
+	if len(data) < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Seq = int64(binary.BigEndian.Uint64(data))
+	data = data[8:]
+
+	// Ratio
+	if len(data) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Ratio = math.Float32frombits(binary.BigEndian.Uint32(data))
+	data = data[4:]
+
+	// Name
+	if len(data) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n1 := uint64(binary.BigEndian.Uint32(data))
+	data = data[4:]
+	if n1 > 16 {
+		return nil, fmt.Errorf("Header.Name: %w: %d > 16", errBinpackTooLong, n1)
+	}
+	if n1 > uint64(len(data)/1) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Name = string(data[:n1])
+	data = data[n1:]
+
+	// Ports
+	if len(data) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n2 := uint64(binary.BigEndian.Uint32(data))
+	data = data[4:]
+	if n2 > uint64(len(data)/2) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Ports = make([]uint16, n2)
+	for i0 := range in.Ports {
+		if len(data) < 2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		in.Ports[i0] = uint16(binary.BigEndian.Uint16(data))
+		data = data[2:]
+	}
+
+	return data, nil
+}
+
+func (in *Header) unpackBinpackFrom(r io.Reader, s *binpackScratch) error {
+	var (
+		b   []byte
+		err error
+	)
+
+	// Version
+	if b, err = s.read(r, 2); err != nil {
+		return err
+	}
+	in.Version = uint16(binary.BigEndian.Uint16(b))
+
+	// Length
+	if b, err = s.read(r, 4); err != nil {
+		return err
+	}
+	in.Length = uint32(binary.BigEndian.Uint32(b))
+
+	// Seq
+	if b, err = s.read(r, 8); err != nil {
+		return err
+	}
+	in.Seq = int64(binary.BigEndian.Uint64(b))
+
+	// Ratio
+	if b, err = s.read(r, 4); err != nil {
+		return err
+	}
+	in.Ratio = math.Float32frombits(binary.BigEndian.Uint32(b))
+
+	// Name
+	if b, err = s.read(r, 4); err != nil {
+		return err
+	}
+	n1 := uint64(binary.BigEndian.Uint32(b))
+	if n1 > 16 {
+		return fmt.Errorf("Header.Name: %w: %d > 16", errBinpackTooLong, n1)
+	}
+	if b, err = s.read(r, n1); err != nil {
+		return err
+	}
+	if string(b) != in.Name {
+		in.Name = string(b)
+	}
+
+	// Ports
+	if b, err = s.read(r, 4); err != nil {
+		return err
+	}
+	n2 := uint64(binary.BigEndian.Uint32(b))
+	in.Ports = in.Ports[:0]
+	for i0 := uint64(0); i0 < n2; i0++ {
+		if i0 < uint64(cap(in.Ports)) {
+			in.Ports = in.Ports[:i0+1]
+		} else {
+			in.Ports = append(in.Ports, *new(uint16))
+		}
+		if b, err = s.read(r, 2); err != nil {
+			return err
+		}
+		in.Ports[i0] = uint16(binary.BigEndian.Uint16(b))
+	}
+
+	return nil
+}
+
+func (in *ShortFrame) Pack() ([]byte, error) {
+	return in.AppendPack(nil)
+}
+
+func (in *ShortFrame) Unpack(data []byte) error {
+	rest, err := in.unpackBinpack(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("ShortFrame: %w: %d", errBinpackTrailing, len(rest))
+	}
+	return nil
+}
+
+// PackTo writes the packed ShortFrame to w in a single Write
+func (in *ShortFrame) PackTo(w io.Writer) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	buf, err := in.AppendPack(s.buf[:0])
+	if err != nil {
+		return err
+	}
+	if cap(buf) <= binpackChunk {
+		s.buf = buf
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// UnpackFrom reads one ShortFrame from r and nothing past it, io.EOF
+// means r ended before the record. The slices and strings of in are
+// reused when they can be, so reading a stream into the same value
+// doesn't allocate
+func (in *ShortFrame) UnpackFrom(r io.Reader) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	s.n = 0
+	return in.unpackBinpackFrom(r, s)
+}
+
+// AppendPack appends the packed ShortFrame to buf
+func (in *ShortFrame) AppendPack(buf []byte) ([]byte, error) {
+	// Tag
+	if uint64(len(in.Tag)) > math.MaxUint8 {
+		return nil, fmt.Errorf("ShortFrame.Tag: %w: %d > %d", errBinpackTooLong, len(in.Tag), uint64(math.MaxUint8))
+	}
+	buf = append(buf, byte(len(in.Tag)))
+	buf = append(buf, in.Tag...)
+
+	// Data
+	if uint64(len(in.Data)) > math.MaxUint8 {
+		return nil, fmt.Errorf("ShortFrame.Data: %w: %d > %d", errBinpackTooLong, len(in.Data), uint64(math.MaxUint8))
+	}
+	buf = append(buf, byte(len(in.Data)))
+	buf = append(buf, in.Data...)
+
+	return buf, nil
+}
+
+func (in *ShortFrame) unpackBinpack(data []byte) ([]byte, error) {
+	// Tag
+	if len(data) < 1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n1 := uint64(data[0])
+	data = data[1:]
+	if n1 > uint64(len(data)/1) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Tag = string(data[:n1])
+	data = data[n1:]
+
+	// Data
+	if len(data) < 1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n2 := uint64(data[0])
+	data = data[1:]
+	if n2 > uint64(len(data)/1) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Data = append(in.Data[:0:0], data[:n2]...)
+	data = data[n2:]
+
+	return data, nil
+}
+
+func (in *ShortFrame) unpackBinpackFrom(r io.Reader, s *binpackScratch) error {
+	var (
+		b   []byte
+		err error
+	)
+
+	// Tag
+	if b, err = s.read(r, 1); err != nil {
+		return err
+	}
+	n1 := uint64(b[0])
+	if b, err = s.read(r, n1); err != nil {
+		return err
+	}
+	if string(b) != in.Tag {
+		in.Tag = string(b)
+	}
+
+	// Data
+	if b, err = s.read(r, 1); err != nil {
+		return err
+	}
+	n2 := uint64(b[0])
+	if b, err = s.read(r, n2); err != nil {
+		return err
+	}
+	in.Data = append(in.Data[:0], b...)
+
+	return nil
+}
+
+func (in *Frame) Pack() ([]byte, error) {
+	return in.AppendPack(nil)
+}
+
+func (in *Frame) Unpack(data []byte) error {
+	rest, err := in.unpackBinpack(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("Frame: %w: %d", errBinpackTrailing, len(rest))
+	}
+	return nil
+}
+
+// PackTo writes the packed Frame to w in a single Write
+func (in *Frame) PackTo(w io.Writer) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	buf, err := in.AppendPack(s.buf[:0])
+	if err != nil {
+		return err
+	}
+	if cap(buf) <= binpackChunk {
+		s.buf = buf
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// UnpackFrom reads one Frame from r and nothing past it, io.EOF
+// means r ended before the record. The slices and strings of in are
+// reused when they can be, so reading a stream into the same value
+// doesn't allocate
+func (in *Frame) UnpackFrom(r io.Reader) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	s.n = 0
+	return in.unpackBinpackFrom(r, s)
+}
+
+// AppendPack appends the packed Frame to buf
+func (in *Frame) AppendPack(buf []byte) ([]byte, error) {
+	// Tag
+	if uint64(len(in.Tag)) > math.MaxUint16 {
+		return nil, fmt.Errorf("Frame.Tag: %w: %d > %d", errBinpackTooLong, len(in.Tag), uint64(math.MaxUint16))
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(in.Tag)))
+	buf = append(buf, in.Tag...)
+
+	// IDs
+	if uint64(len(in.IDs)) > math.MaxUint16 {
+		return nil, fmt.Errorf("Frame.IDs: %w: %d > %d", errBinpackTooLong, len(in.IDs), uint64(math.MaxUint16))
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(in.IDs)))
+	for i0 := range in.IDs {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(in.IDs[i0]))
+	}
+
+	return buf, nil
+}
+
+func (in *Frame) unpackBinpack(data []byte) ([]byte, error) {
+	// Tag
+	if len(data) < 2 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n1 := uint64(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	if n1 > uint64(len(data)/1) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Tag = string(data[:n1])
+	data = data[n1:]
+
+	// IDs
+	if len(data) < 2 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n2 := uint64(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	if n2 > uint64(len(data)/4) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.IDs = make([]int32, n2)
+	for i0 := range in.IDs {
+		if len(data) < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		in.IDs[i0] = int32(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+	}
+
+	return data, nil
+}
+
+func (in *Frame) unpackBinpackFrom(r io.Reader, s *binpackScratch) error {
+	var (
+		b   []byte
+		err error
+	)
+
+	// Tag
+	if b, err = s.read(r, 2); err != nil {
+		return err
+	}
+	n1 := uint64(binary.LittleEndian.Uint16(b))
+	if b, err = s.read(r, n1); err != nil {
+		return err
+	}
+	if string(b) != in.Tag {
+		in.Tag = string(b)
+	}
+
+	// IDs
+	if b, err = s.read(r, 2); err != nil {
+		return err
+	}
+	n2 := uint64(binary.LittleEndian.Uint16(b))
+	in.IDs = in.IDs[:0]
+	for i0 := uint64(0); i0 < n2; i0++ {
+		if i0 < uint64(cap(in.IDs)) {
+			in.IDs = in.IDs[:i0+1]
+		} else {
+			in.IDs = append(in.IDs, *new(int32))
+		}
+		if b, err = s.read(r, 4); err != nil {
+			return err
+		}
+		in.IDs[i0] = int32(binary.LittleEndian.Uint32(b))
+	}
+
+	return nil
+}
+
+func (in *LongFrame) Pack() ([]byte, error) {
+	return in.AppendPack(nil)
+}
+
+func (in *LongFrame) Unpack(data []byte) error {
+	rest, err := in.unpackBinpack(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("LongFrame: %w: %d", errBinpackTrailing, len(rest))
+	}
+	return nil
+}
+
+// PackTo writes the packed LongFrame to w in a single Write
+func (in *LongFrame) PackTo(w io.Writer) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	buf, err := in.AppendPack(s.buf[:0])
+	if err != nil {
+		return err
+	}
+	if cap(buf) <= binpackChunk {
+		s.buf = buf
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// UnpackFrom reads one LongFrame from r and nothing past it, io.EOF
+// means r ended before the record. The slices and strings of in are
+// reused when they can be, so reading a stream into the same value
+// doesn't allocate
+func (in *LongFrame) UnpackFrom(r io.Reader) error {
+	s := binpackScratchPool.Get().(*binpackScratch)
+	defer binpackScratchPool.Put(s)
+
+	s.n = 0
+	return in.unpackBinpackFrom(r, s)
+}
+
+// AppendPack appends the packed LongFrame to buf
+func (in *LongFrame) AppendPack(buf []byte) ([]byte, error) {
+	// Data
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(in.Data)))
+	buf = append(buf, in.Data...)
+
+	return buf, nil
+}
+
+func (in *LongFrame) unpackBinpack(data []byte) ([]byte, error) {
+	// Data
+	if len(data) < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n1 := uint64(binary.LittleEndian.Uint64(data))
+	data = data[8:]
+	if n1 > uint64(len(data)/1) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	in.Data = append(in.Data[:0:0], data[:n1]...)
+	data = data[n1:]
+
+	return data, nil
+}
+
+func (in *LongFrame) unpackBinpackFrom(r io.Reader, s *binpackScratch) error {
+	var (
+		b   []byte
+		err error
+	)
+
+	// Data
+	if b, err = s.read(r, 8); err != nil {
+		return err
+	}
+	n1 := uint64(binary.LittleEndian.Uint64(b))
+	if b, err = s.read(r, n1); err != nil {
+		return err
+	}
+	in.Data = append(in.Data[:0], b...)
+
 	return nil
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// packedUser is benchUser as perl packs it with "L L/a* L"
+var packedUser = []byte{
+	128, 36, 17, 0,
+	9, 0, 0, 0,
+	118, 46, 114, 111, 109, 97, 110, 111, 118,
+	16, 0, 0, 0,
+}
+
+// join concatenates the parts of a packed record
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestUserRoundTrip(t *testing.T) {
+	packed, err := benchUser.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, packedUser) {
+		t.Errorf("packed %v, want %v", packed, packedUser)
+	}
+
+	u := User{RealName: "kept"}
+	if err := u.Unpack(packed); err != nil {
+		t.Fatal(err)
+	}
+	if want := (User{ID: benchUser.ID, RealName: "kept", Login: benchUser.Login, Flags: benchUser.Flags}); u != want {
+		t.Errorf("unpacked %#v, want %#v", u, want)
+	}
+
+	u = User{}
+	if err := u.UnpackFrom(bytes.NewReader(packed)); err != nil || u != benchUser {
+		t.Errorf("read %#v, %v", u, err)
+	}
+}
+
+func TestUserUnpack(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		err  error // of Unpack
+		from error // of UnpackFrom reading the data
+	}{
+		{"valid", packedUser, nil, nil},
+		{"empty login", join(packedUser[:4], []byte{0, 0, 0, 0}, packedUser[17:]), nil, nil},
+		{"empty", nil, io.ErrUnexpectedEOF, io.EOF},
+		{"truncated id", packedUser[:2], io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+		{"no login length", packedUser[:4], io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+		{"truncated login length", packedUser[:6], io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+		{"no login", packedUser[:8], io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+		{"truncated login", packedUser[:12], io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+		{"no flags", packedUser[:17], io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+		{"truncated flags", packedUser[:19], io.ErrUnexpectedEOF, io.ErrUnexpectedEOF},
+		// UnpackFrom leaves the next record in the stream
+		{"trailing bytes", join(packedUser, []byte{0}), errBinpackTrailing, nil},
+		{"login at max", join(packedUser[:4], []byte{64, 0, 0, 0}, []byte(strings.Repeat("a", 64)), packedUser[17:]), nil, nil},
+		{"login over max", join(packedUser[:4], []byte{65, 0, 0, 0}, []byte(strings.Repeat("a", 65)), packedUser[17:]), errBinpackTooLong, errBinpackTooLong},
+		{"huge login length", join(packedUser[:4], []byte{255, 255, 255, 255}), errBinpackTooLong, errBinpackTooLong},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := User{}
+			if err := u.Unpack(tc.data); !errors.Is(err, tc.err) {
+				t.Errorf("Unpack: got %v, want %v", err, tc.err)
+			}
+			u = User{}
+			if err := u.UnpackFrom(bytes.NewReader(tc.data)); !errors.Is(err, tc.from) {
+				t.Errorf("UnpackFrom: got %v, want %v", err, tc.from)
+			}
+		})
+	}
+}
+
+func TestUserPack(t *testing.T) {
+	cases := []struct {
+		name string
+		user User
+		err  error
+	}{
+		{"valid", benchUser, nil},
+		{"login at max", User{Login: strings.Repeat("a", 64)}, nil},
+		{"login over max", User{Login: strings.Repeat("a", 65)}, errBinpackTooLong},
+		{"negative id", User{ID: -1}, errBinpackRange},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			packed, err := tc.user.Pack()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			u := User{}
+			if err := u.Unpack(packed); err != nil || u != tc.user {
+				t.Errorf("unpacked %#v, %v", u, err)
+			}
+		})
+	}
+}
+
+func TestUserAppendPack(t *testing.T) {
+	dst := append(make([]byte, 0, 64), 1, 2)
+	buf, err := benchUser.AppendPack(dst)
+	if err != nil || !bytes.Equal(buf, join([]byte{1, 2}, packedUser)) {
+		t.Errorf("appended %v, %v", buf, err)
+	}
+
+	// the checks fail after ID is appended, only nil and the error return
+	bad := User{ID: 1, Login: strings.Repeat("a", 65)}
+	if buf, err := bad.AppendPack(dst); !errors.Is(err, errBinpackTooLong) || buf != nil || !bytes.Equal(dst, []byte{1, 2}) {
+		t.Errorf("appended %v, %v, dst %v", buf, err, dst)
+	}
+}
@@ -1,14 +1,17 @@
 // go build gen/* && ./codegen.exe pack/packer.go  pack/marshaller.go
 package main
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+)
 
 // lets generate code for this struct
 // cgen: binpack
 type User struct {
 	ID       int
 	RealName string `cgen:"-"`
-	Login    string
+	Login    string `cgen:"max=64"`
 	Flags    int
 }
 
@@ -17,6 +20,35 @@ type Avatar struct {
 	Url string
 }
 
+// the structs below cover the format options, see formats_test.go
+
+// cgen: binpack endian=big
+type Header struct {
+	Version uint16
+	Length  uint32
+	Seq     int64
+	Ratio   float32
+	Name    string `cgen:"max=16"`
+	Ports   []uint16
+}
+
+// cgen: binpack lenprefix=u8
+type ShortFrame struct {
+	Tag  string
+	Data []byte
+}
+
+// cgen: binpack lenprefix=u16
+type Frame struct {
+	Tag string
+	IDs []int32
+}
+
+// cgen: binpack lenprefix=u64
+type LongFrame struct {
+	Data []byte
+}
+
 var test = 42
 
 func main() {
@@ -34,6 +66,21 @@ func main() {
 	}
 
 	u := User{}
-	u.Unpack(data)
-	fmt.Printf("Unpacked user %#v", u)
+	if err := u.Unpack(data); err != nil {
+		fmt.Println("unpack error:", err)
+		return
+	}
+	fmt.Printf("Unpacked user %#v\n", u)
+
+	packed, err := u.Pack()
+	if err != nil {
+		fmt.Println("pack error:", err)
+		return
+	}
+	fmt.Printf("Packed back equal: %v\n", bytes.Equal(packed, data))
+
+	// truncated input, trailing bytes and a crafted length are rejected
+	fmt.Println("truncated:", u.Unpack(data[:len(data)-1]))
+	fmt.Println("trailing:", u.Unpack(append(packed, 0)))
+	fmt.Println("too long:", u.Unpack([]byte{1, 0, 0, 0, 255, 255, 255, 255}))
 }
@@ -0,0 +1,13 @@
+module hw5_codegen
+
+go 1.26.0
+
+require (
+	github.com/pkg/errors v0.9.1
+	golang.org/x/tools v0.50.0
+)
+
+require (
+	golang.org/x/mod v0.41.0 // indirect
+	golang.org/x/sync v0.23.0 // indirect
+)
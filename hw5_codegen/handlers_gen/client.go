@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// fieldFormatters turn a field value into the query value decoded by fieldParsers
+var fieldFormatters = map[string]string{
+	"int":       "strconv.Itoa(%s)",
+	"int64":     "strconv.FormatInt(%s, 10)",
+	"uint":      "strconv.FormatUint(uint64(%s), 10)",
+	"float64":   "strconv.FormatFloat(%s, 'g', -1, 64)",
+	"bool":      "strconv.FormatBool(%s)",
+	"time.Time": "%s.Format(time.RFC3339)",
+}
+
+var clientHelpersTmpl = `
+{{- if not .HasApiError}}
+
+// ApiError is returned by the clients for responses with an error
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+{{- end}}
+
+// apigenClientFile is a file sent in a multipart body, the content of
+// a header is read with Open, so it must come from a received form
+type apigenClientFile struct {
+	param  string
+	header *multipart.FileHeader
+	reader io.Reader
+}
+
+// apigenClientSend sends params as a query string, a form body or, with
+// files, a multipart body; the {"error"} of failed calls is returned as ApiError
+func apigenClientSend(ctx context.Context, client *http.Client, method, endpoint string,
+	params url.Values, files []apigenClientFile, authorize func(r *http.Request) error) (*http.Response, error) {
+
+	var body io.Reader
+	contentType := "application/x-www-form-urlencoded"
+	switch {
+	case len(files) > 0:
+		form, formType, err := apigenClientMultipart(params, files)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = form, formType
+	case method == http.MethodPost:
+		body = strings.NewReader(params.Encode())
+	case len(params) > 0:
+		endpoint += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if authorize != nil {
+		if err := authorize(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	envelope := struct {
+		Error string ` + "`json:\"error\"`" + `
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil || envelope.Error == "" {
+		return nil, ApiError{HTTPStatus: resp.StatusCode, Err: errors.New(resp.Status)}
+	}
+	return nil, ApiError{HTTPStatus: resp.StatusCode, Err: errors.New(envelope.Error)}
+}
+
+// apigenClientDo decodes the response field of the {"error", "response"}
+// envelope into out
+func apigenClientDo(ctx context.Context, client *http.Client, method, endpoint string,
+	params url.Values, files []apigenClientFile, authorize func(r *http.Request) error, out interface{}) error {
+
+	resp, err := apigenClientSend(ctx, client, method, endpoint, params, files, authorize)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	envelope := struct {
+		Error    string          ` + "`json:\"error\"`" + `
+		Response json.RawMessage ` + "`json:\"response\"`" + `
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return err
+	}
+
+	if envelope.Error != "" {
+		return ApiError{HTTPStatus: resp.StatusCode, Err: errors.New(envelope.Error)}
+	}
+
+	if len(envelope.Response) == 0 {
+		return nil
+	}
+	return json.Unmarshal(envelope.Response, out)
+}
+
+// apigenClientMultipart encodes params and files as multipart/form-data
+func apigenClientMultipart(params url.Values, files []apigenClientFile) (io.Reader, string, error) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+
+	for name, values := range params {
+		for _, value := range values {
+			if err := form.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	for _, file := range files {
+		name, content := file.param, file.reader
+		if file.header != nil {
+			f, err := file.header.Open()
+			if err != nil {
+				return nil, "", err
+			}
+			defer f.Close()
+			name, content = file.header.Filename, f
+		}
+
+		part, err := form.CreateFormFile(file.param, name)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := io.Copy(part, content); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, form.FormDataContentType(), nil
+}
+{{- if .HasResponse "ndjson" "sse"}}
+
+// apigenClientEvents returns the items of a newline delimited JSON or
+// server-sent events body one by one, io.EOF follows the last one
+func apigenClientEvents(body io.Reader, sse bool) func() ([]byte, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, 16<<20)
+
+	return func() ([]byte, error) {
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if sse {
+				if !bytes.HasPrefix(line, []byte("data:")) {
+					continue
+				}
+				line = bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+			}
+			if len(bytes.TrimSpace(line)) > 0 {
+				return line, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+{{- end}}
+`
+
+var clientTmpl = `
+// {{.Receiver}}Client calls {{.Receiver}} endpoints over http
+type {{.Receiver}}Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Prefix is put in front of the endpoint urls, it is the apigen:service
+	// prefix of the api on the Router; clear it to call the api served on its own
+	Prefix string
+
+	// Token is sent in the X-Auth header to the endpoints requiring auth,
+	// set Authorize to authenticate requests in another way
+	Token     string
+	Authorize func(r *http.Request) error
+}
+
+func New{{.Receiver}}Client(baseURL string) *{{.Receiver}}Client {
+	return &{{.Receiver}}Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		Prefix:     {{prefix .Receiver | printf "%q"}},
+	}
+}
+
+func (c *{{.Receiver}}Client) authorize(r *http.Request) error {
+	if c.Authorize != nil {
+		return c.Authorize(r)
+	}
+	r.Header.Set("X-Auth", c.Token)
+	return nil
+}
+
+{{- range .Handler}}
+
+func (c *{{.Receiver}}Client) {{.StructMethod}}(ctx context.Context, in {{.Param}}) ({{.Result}}, error) {
+	endpoint := c.BaseURL + c.Prefix + {{printf "%q" .Url}}
+	params := url.Values{}
+	{{- if .Struct.HasFiles}}
+	var files []apigenClientFile
+	{{- end}}
+	{{- range .Struct.Fields}}
+	{{- if .File}}
+	if in.{{.FieldName}} != nil {
+		files = append(files, apigenClientFile{param: {{printf "%q" .ParamName}}, {{.File}}: in.{{.FieldName}}})
+	}
+	{{- else if .Path}}
+	endpoint = strings.Replace(endpoint, {{printf "{%s}" .ParamName | printf "%q"}}, url.PathEscape({{format . (printf "in.%s" .FieldName)}}), 1)
+	{{- else if .Slice}}
+	for _, v := range in.{{.FieldName}} {
+		params.Add({{printf "%q" .ParamName}}, {{format . "v"}})
+	}
+	{{- else if .Pointer}}
+	if in.{{.FieldName}} != nil {
+		params.Set({{printf "%q" .ParamName}}, {{format . (printf "*in.%s" .FieldName)}})
+	}
+	{{- else}}
+	if !({{empty . (printf "in.%s" .FieldName)}}) {
+		params.Set({{printf "%q" .ParamName}}, {{format . (printf "in.%s" .FieldName)}})
+	}
+	{{- end}}
+	{{- end}}
+
+	{{- if .Response}}
+
+	resp, err := apigenClientSend(ctx, c.HTTPClient, {{template "method" .}}, endpoint,
+		params, {{template "files" .}}, {{if .Auth}}c.authorize{{else}}nil{{end}})
+	if err != nil {
+		return nil, err
+	}
+	{{- if eq .Response "raw"}}
+	return resp.Body, nil
+	{{- else}}
+
+	items := make(chan {{.StreamElem}})
+	go func() {
+		defer close(items)
+		defer resp.Body.Close()
+
+		next := apigenClientEvents(resp.Body, {{eq .Response "sse"}})
+		for {
+			data, err := next()
+			if err != nil {
+				return
+			}
+			var item {{.StreamElem}}
+			if err := json.Unmarshal(data, &item); err != nil {
+				return
+			}
+			select {
+			case items <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return items, nil
+	{{- end}}
+	{{- else}}
+
+	var res {{.Result}}
+	err := apigenClientDo(ctx, c.HTTPClient, {{template "method" .}}, endpoint,
+		params, {{template "files" .}}, {{if .Auth}}c.authorize{{else}}nil{{end}}, &res)
+	return res, err
+	{{- end}}
+}
+{{- end}}
+
+{{- define "method"}}{{if eq .Method "POST"}}http.MethodPost{{else}}http.MethodGet{{end}}{{end}}
+{{- define "files"}}{{if .Struct.HasFiles}}files{{else}}nil{{end}}{{end}}
+`
+
+// RenderClient writes a <Receiver>Client type for every api, with a method
+// per endpoint taking the same params and returning the same result. The
+// clients are written in the package of the apis to share these types, so
+// the clients of apis declared in package main can't be imported
+func RenderClient() ([]byte, error) {
+	container := GetCollector()
+
+	imports := map[string]bool{
+		"bytes":          true,
+		"context":        true,
+		"encoding/json":  true,
+		"errors":         true,
+		"io":             true,
+		"mime/multipart": true,
+		"net/http":       true,
+		"net/url":        true,
+		"strings":        true,
+	}
+	if container.HasResponse("ndjson", "sse") {
+		imports["bufio"] = true
+	}
+
+	t := template.Must(template.New("client").Funcs(template.FuncMap{
+		"empty": emptyCheck,
+		"prefix": func(receiver string) string {
+			if service := container.service(receiver); service != nil {
+				return service.Prefix
+			}
+			return ""
+		},
+		"format": func(field *StructField, value string) string {
+			if field.ElemType != field.BaseType {
+				value = field.BaseType + "(" + value + ")"
+			}
+			switch field.BaseType {
+			case "string":
+				return value
+			case "time.Time":
+				imports["time"] = true
+			default:
+				imports["strconv"] = true
+			}
+			return fmt.Sprintf(fieldFormatters[field.BaseType], value)
+		},
+	}).Parse(clientTmpl))
+
+	out := &bytes.Buffer{}
+	if err := template.Must(template.New("clientHelpers").Parse(clientHelpersTmpl)).Execute(out, container); err != nil {
+		return nil, err
+	}
+
+	receivers := container.receiverHandlers()
+	for _, rh := range receivers {
+		for _, handler := range rh.Handler {
+			for _, spec := range container.typeImports(handler.ParamType) {
+				imports[spec] = true
+			}
+			for _, spec := range container.typeImports(handler.ResultType) {
+				imports[spec] = true
+			}
+		}
+	}
+
+	for _, rh := range receivers {
+		if err := t.Execute(out, rh); err != nil {
+			return nil, err
+		}
+	}
+
+	return renderGoFile(container.Package, sortedKeys(imports), out.Bytes())
+}
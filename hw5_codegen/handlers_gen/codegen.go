@@ -1,354 +1,2369 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"flag"
 	"fmt"
 	"github.com/pkg/errors"
 	"go/ast"
-	"go/parser"
+	"go/format"
 	"go/token"
+	"go/types"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 )
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s <file.go|dir>... <output.go>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	check := flag.Bool("check", false, "do not write the output, exit with status 1 if it is out of date")
+	openAPI := flag.String("openapi", "", "also write an OpenAPI 3 spec to this `file` (.json, .yaml); "+
+		"{receiver} in the name is replaced by the api type, one spec per type")
+	client := flag.String("client", "", "also write typed http clients of the apis to this `file`, "+
+		"in the package of the apis; clients of package main apis can't be imported")
+	tests := flag.String("tests", "", "also write tests of the endpoints derived from the apivalidator tags "+
+		"to this `file`, named like *_test.go")
+	metrics := flag.Bool("metrics", false, "count the requests, errors and latency of the endpoints "+
+		"and serve them on "+metricsPath+" and MetricsHandler in the Prometheus text format")
+	flag.Parse()
+	log.SetFlags(0)
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	inputs := flag.Args()[:flag.NArg()-1]
+	output := flag.Arg(flag.NArg() - 1)
+
+	files, err := sourceFiles(inputs, output)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, os.Args[1], nil, parser.ParseComments)
+	collector := GetCollector()
+	collector.fset = fset
+	collector.Metrics = *metrics
+
+	pkg, err := loadPackage(fset, files)
 	if err != nil {
 		log.Fatal(err)
 	}
+	collector.Package = pkg.Name
+	collector.pkg, collector.info = pkg.Types, pkg.TypesInfo
 
-	ast.Inspect(node, func(node ast.Node) bool {
-		return visitor(node)
-	})
+	for _, node := range pkg.Syntax {
+		if ast.IsGenerated(node) {
+			continue
+		}
 
-	RenderHTTPWrapper()
-}
+		ast.Inspect(node, func(node ast.Node) bool {
+			return visitor(node)
+		})
+	}
 
-type HandlersMapping struct {
-	Handler map[string][]*HandlerContainer
-}
+	collector.resolveAll()
+	collector.checkHandlers()
+	collector.checkServices()
+	collector.reportDiagnostics()
 
-func RenderHTTPWrapper() {
-	container := GetCollector()
+	src, err := RenderHTTPWrapper()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	outputs := map[string][]byte{output: src}
 
-	outFile, _ := os.Create("/Users/alexandermykolaichuk/playground/coursera-golang/hw5_codegen/someTest.go")
+	if *openAPI != "" {
+		receivers := collector.receivers()
+		if len(receivers) > 1 && !strings.Contains(*openAPI, "{receiver}") {
+			log.Fatalf("-openapi: several apis found (%s), add {receiver} to the file name", strings.Join(receivers, ", "))
+		}
 
-	hm := &HandlersMapping{
-		Handler: make(map[string][]*HandlerContainer),
+		for _, receiver := range receivers {
+			path := strings.Replace(*openAPI, "{receiver}", receiver, -1)
+			if outputs[path], err = RenderOpenAPI(receiver, path); err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
 
-	for _, handler := range container.HandlerContainer {
-		handler.ValidationTemplate = generateValidationCode(handler.Param)
-		hm.Handler[handler.Receiver] = append(hm.Handler[handler.Receiver], handler)
+	if *client != "" {
+		if outputs[*client], err = RenderClient(); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	var headTmpl = `
-		package main
+	if *tests != "" {
+		if !strings.HasSuffix(*tests, "_test.go") {
+			log.Fatalf("-tests: %s is not a _test.go file", *tests)
+		}
+		if outputs[*tests], err = RenderTests(); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-		import (
-			"encoding/json"
-			"io/ioutil"
-			"net/http"
-			"net/url"
-		)
+	stale := false
+	for path, data := range outputs {
+		if !*check {
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
 
-	`
-	_, _ = fmt.Fprintln(outFile, headTmpl)
+		current, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(current, data) {
+			fmt.Fprintf(os.Stderr, "%s is out of date, regenerate it with %s\n", path, filepath.Base(os.Args[0]))
+			stale = true
+		}
+	}
 
-	var serveHTTPTmpl = `
-		func (srv *{{.Receiver}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-			switch r.URL.Path {
-				{{range .Handler}}
-					case "{{.Url}}":
-					func(w http.ResponseWriter, r *http.Request) {
+	if stale {
+		os.Exit(1)
+	}
+}
 
-						fnParams := {{.Param}}{}
-						var queryString string
+// sourceFiles expands directories into the .go files of the package they hold,
+// skipping tests and the output file itself. Other generated files are dropped
+// after parsing, see ast.IsGenerated
+func sourceFiles(inputs []string, output string) ([]string, error) {
+	outputAbs, err := filepath.Abs(output)
+	if err != nil {
+		return nil, err
+	}
 
-		if r.Method == "POST" {
-			body, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				http.Error(w, "Bad request", http.StatusBadRequest)
-				return
+	var files []string
+
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, input)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(input, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			if strings.HasSuffix(match, "_test.go") {
+				continue
+			}
+
+			if abs, _ := filepath.Abs(match); abs == outputAbs {
+				continue
 			}
 
-			defer r.Body.Close()
+			files = append(files, match)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("no go files to parse")
+	}
+
+	return files, nil
+}
+
+const generatedHeader = "// Code generated by handlers_gen. DO NOT EDIT."
+
+// defaultMaxBody limits request bodies of endpoints without "max_body"
+const defaultMaxBody = 1 << 20
+
+// helpersTmpl is shared by the handlers of all receivers in the output file
+var helpersTmpl = template.Must(template.New("helpers").Parse(`
+// apigenAuthorizer can be implemented by an api to replace the default
+// X-Auth header check of the endpoints marked with "auth": true
+type apigenAuthorizer interface {
+	Authorize(r *http.Request) error
+}
+
+// Endpoint describes the api method a request is routed to, PathParams
+// holds the values of the url placeholders; Params points to the params
+// of the method once they are filled and valid, so middlewares see them
+// after calling next only
+type Endpoint struct {
+	Receiver   string
+	Name       string
+	Method     string
+	URL        string
+	PathParams url.Values
+	Params     interface{}
+	{{- if .Metrics}}
+
+	metrics *apigenEndpointMetrics
+	{{- end}}
+}
+
+// HandlerFunc serves a request routed to an endpoint
+type HandlerFunc func(w http.ResponseWriter, r *http.Request, endpoint *Endpoint)
+
+// Middleware wraps the endpoints of an api implementing
+// Middlewares() []Middleware, the first one is the outermost;
+// Middlewares is called once per api and endpoint
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type apigenMiddlewares interface {
+	Middlewares() []Middleware
+}
+
+// apigenChainKey identifies the handler of an endpoint of an api
+type apigenChainKey struct {
+	srv      interface{}
+	receiver string
+	name     string
+}
+
+// apigenChains holds the handlers wrapped into the middlewares
+var apigenChains sync.Map
+
+// apigenStatusError lets errors declared outside of this package choose
+// the HTTP status they are reported with
+type apigenStatusError interface {
+	HTTPStatus() int
+}
+
+func apigenAuthorize(srv interface{}, r *http.Request) error {
+	if a, ok := srv.(apigenAuthorizer); ok {
+		return a.Authorize(r)
+	}
+	if r.Header.Get("X-Auth") != "100500" {
+		return errors.New("unauthorized")
+	}
+	return nil
+}
+
+// apigenErrorStatus finds the HTTP status of err, falling back to
+// the given one for errors that don't carry a status
+func apigenErrorStatus(err error, fallback int) int {
+	{{- if .HasApiError}}
+	var apiErr ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatus
+	}
+	{{- end}}
+	var statusErr apigenStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.HTTPStatus()
+	}
+	return fallback
+}
+
+// apigenServe runs the handler inside the middlewares of srv,
+// panics are logged and answered with 500
+func apigenServe(srv interface{}, w http.ResponseWriter, r *http.Request, endpoint *Endpoint, handler HandlerFunc) {
+	{{- if .Metrics}}
+	if endpoint.metrics != nil {
+		start := time.Now()
+		sw := &apigenStatusWriter{ResponseWriter: w}
+		w = sw
+		defer func() {
+			endpoint.metrics.observe(sw.status, time.Since(start))
+		}()
+	}
 
-			queryString = string(body)
+	{{- end}}
+	defer func() {
+		if p := recover(); p != nil {
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			log.Printf("apigen: panic serving %s.%s: %v\n%s", endpoint.Receiver, endpoint.Name, p, debug.Stack())
+			apigenWriteError(w, http.StatusInternalServerError, "internal error")
+		}
+	}()
 
+	if m, ok := srv.(apigenMiddlewares); ok {
+		key := apigenChainKey{srv: srv, receiver: endpoint.Receiver, name: endpoint.Name}
+		if chain, ok := apigenChains.Load(key); ok {
+			handler = chain.(HandlerFunc)
 		} else {
-			queryString = r.URL.RawQuery
+			middlewares := m.Middlewares()
+			for i := len(middlewares) - 1; i >= 0; i-- {
+				handler = middlewares[i](handler)
+			}
+			chain, _ := apigenChains.LoadOrStore(key, handler)
+			handler = chain.(HandlerFunc)
 		}
+	}
+
+	handler(w, r, endpoint)
+}
+
+func apigenWriteError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&struct {
+		Error string ` + "`json:\"error\"`" + `
+	}{
+		Error: message,
+	})
+}
+
+// apigenError is an error with the HTTP status it is reported with
+type apigenError struct {
+	status  int
+	message string
+}
+
+func (e apigenError) Error() string {
+	return e.message
+}
 
+func (e apigenError) HTTPStatus() int {
+	return e.status
+}
 
-	q, _ := url.ParseQuery(queryString)
+// apigenReadParams takes the params from the query string or, for POST
+// requests, from a form or JSON body of at most maxBody bytes; types are
+// the types of the params a JSON body is checked against
+func apigenReadParams(r *http.Request, maxBody int64, types map[string]string) (url.Values, error) {
+	if r.Method != http.MethodPost {
+		return r.URL.Query(), nil
+	}
 
-	values := make(map[string]string)
-	for key := range q {
-		values[key] = q.Get(key)
+	mediaType := "application/x-www-form-urlencoded"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, apigenError{http.StatusUnsupportedMediaType, "unsupported content type"}
+		}
+	}
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "application/json" {
+		return nil, apigenError{http.StatusUnsupportedMediaType, "unsupported content type"}
 	}
-	
-	JSON, err := json.Marshal(values)
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
 	if err != nil {
-		panic(err)
+		return nil, apigenError{http.StatusBadRequest, "bad request"}
+	}
+	if int64(len(body)) > maxBody {
+		return nil, apigenError{http.StatusRequestEntityTooLarge, "request body too large"}
+	}
+
+	if mediaType == "application/json" {
+		return apigenJSONValues(body, types)
 	}
-	
-	_ = json.Unmarshal(JSON, &fnParams)
 
-	{{ .ValidationTemplate.Template }}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, apigenError{http.StatusBadRequest, "bad request"}
+	}
+	return values, nil
+}
 
+// apigenJSONValues flattens a JSON object into values the same way the
+// params are sent in a form: arrays become repeated keys and nested
+// objects dotted keys, so the same decoding and validation apply to both
+func apigenJSONValues(body []byte, types map[string]string) (url.Values, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
 
-						res, err := srv.{{.StructMethod}}(r.Context(), fnParams)
-						if err != nil {
-							http.Error(w, err.Error(), err.(ApiError).HTTPStatus)
-						}
+	var object map[string]interface{}
+	if err := dec.Decode(&object); err != nil {
+		return nil, apigenError{http.StatusBadRequest, "bad json"}
+	}
 
-						encoder := json.NewEncoder(w)
+	values := url.Values{}
+	if err := apigenFlattenJSON(values, types, "", object); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
 
-						_ = encoder.Encode(&struct{
-							Error string ` + "`" + `json:"error"`+ "`" + `
-							Response interface{}` + "`" + `json:"response, omitempty"` + "`" + `
-						}{
-							Error: "",
-							Response: res,
-						})
+// apigenFlattenJSON adds the value of the param key, which must have the
+// JSON kind of its type: a string, a number or a bool, in an array for
+// slices; unknown keys are ignored like unknown form values
+func apigenFlattenJSON(values url.Values, types map[string]string, key string, value interface{}) error {
+	typ, known := types[key]
+	if object, ok := value.(map[string]interface{}); ok && !known {
+		for name, item := range object {
+			if key != "" {
+				name = key + "." + name
+			}
+			if err := apigenFlattenJSON(values, types, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !known || value == nil {
+		return nil
+	}
 
-					}(w, r)
+	elem := strings.TrimPrefix(typ, "[]")
+	items := []interface{}{value}
+	if elem != typ {
+		list, ok := value.([]interface{})
+		if !ok {
+			return apigenError{http.StatusBadRequest, key + " must be " + typ}
+		}
+		items = list
+	}
 
-				{{end}}
-					default:
-					// 404
+	for _, item := range items {
+		var raw string
+		switch v := item.(type) {
+		case string:
+			if elem != "string" && elem != "time.Time" {
+				return apigenError{http.StatusBadRequest, key + " must be " + typ}
+			}
+			raw = v
+		case json.Number:
+			if elem != "int" && elem != "int64" && elem != "uint" && elem != "float64" {
+				return apigenError{http.StatusBadRequest, key + " must be " + typ}
 			}
+			raw = v.String()
+		case bool:
+			if elem != "bool" {
+				return apigenError{http.StatusBadRequest, key + " must be " + typ}
+			}
+			raw = strconv.FormatBool(v)
+		default:
+			return apigenError{http.StatusBadRequest, key + " must be " + typ}
 		}
-	`
+		values.Add(key, raw)
+	}
+	return nil
+}
 
+func apigenSplitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
 
-	t := template.Must(template.New("funcTemp").Parse(serveHTTPTmpl))
+// apigenMatchPath compares the escaped request path segments with a route,
+// where empty route segments are placeholders for the names in order
+func apigenMatchPath(segments, route []string, names ...string) (url.Values, bool) {
+	if len(segments) != len(route) {
+		return nil, false
+	}
 
-	for receiver, handler := range hm.Handler {
-		err := t.Execute(outFile, struct {
-			Receiver string
-			Handler []*HandlerContainer
-		}{
-			receiver,
-			handler,
-		})
-		if err != nil {
-			panic(err)
+	params := url.Values{}
+	for i, segment := range route {
+		if segment != "" {
+			if segments[i] != segment {
+				return nil, false
+			}
+			continue
 		}
 
+		value, err := url.PathUnescape(segments[i])
+		if err != nil || value == "" {
+			return nil, false
+		}
+		params.Set(names[0], value)
+		names = names[1:]
 	}
 
-
+	return params, true
 }
 
-type HandlerContainer struct {
-	Url string
-	Auth bool
-	Method string
-	Param string
-	Receiver string
-	StructMethod string
-	ValidationTemplate *ValidationTemplate
+func apigenWriteResponse(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&struct {
+		Error    string      ` + "`json:\"error\"`" + `
+		Response interface{} ` + "`json:\"response,omitempty\"`" + `
+	}{
+		Response: response,
+	})
 }
 
-type StructContainer struct {
-	Name string
-	Fields []*StructField
+// ValidationError is a violated apivalidator rule, Field is the name of
+// the struct field and Param the name of the request param
+type ValidationError struct {
+	Field   string ` + "`json:\"-\"`" + `
+	Param   string ` + "`json:\"param\"`" + `
+	Rule    string ` + "`json:\"rule\"`" + `
+	Message string ` + "`json:\"message\"`" + `
+
+	// order is the position of the field, the cross-field rules
+	// are placed after all the fields
+	order int
 }
 
-type StructField struct {
-	FieldName string
-	FieldType string
-	Validation []string
+func (e *ValidationError) Error() string {
+	return e.Message
 }
 
-type ValidationTemplate struct {
-	ParamName string
-	Template string
+// ValidationErrors holds the violations in the order of the fields,
+// every rule of a field is checked unless the field is missing
+// or can't be parsed
+type ValidationErrors []*ValidationError
+
+// add appends err unless the field already broke the same rule,
+// as the rules of a slice are checked for every element
+func (errs ValidationErrors) add(err *ValidationError) ValidationErrors {
+	for _, e := range errs {
+		if e.Field == err.Field && e.Rule == err.Rule {
+			return errs
+		}
+	}
+	return append(errs, err)
 }
 
-func (c *Collector) getStructContainerByName(name string) (*StructContainer, error) {
-	for _, container := range c.StructContainer {
-		if container.Name == name {
-			return container, nil
+// has tells whether the field broke a rule already
+func (errs ValidationErrors) has(field string) bool {
+	for _, err := range errs {
+		if err.Field == field {
+			return true
 		}
 	}
+	return false
+}
 
-	return nil, errors.New("Container not found")
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
 }
 
-func generateValidationCode(param string) *ValidationTemplate {
-	container := GetCollector()
-	structContainer, _:= container.getStructContainerByName(param)
+func (errs ValidationErrors) Unwrap() []error {
+	unwrapped := make([]error, 0, len(errs))
+	for _, err := range errs {
+		unwrapped = append(unwrapped, err)
+	}
+	return unwrapped
+}
 
-	var fieldsTmpl string
+// orNil puts the violations in the order of the fields, the fields
+// are parsed before any of them are checked
+func (errs ValidationErrors) orNil() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].order < errs[j].order
+	})
+	return errs
+}
 
-	for _, field := range structContainer.Fields {
-		for _, validation := range field.Validation {
-			if validation == "required" {
-				fieldsTmpl = `if fnParams` + "." + field.FieldName + ` == "" {
-						encoder := json.NewEncoder(w)
-		
-						w.WriteHeader(http.StatusBadRequest)
-		
-						_ = encoder.Encode(&struct{
-							Error string `+ "`" + `json:"error"` + "`" + `
-						}{
-							Error: "login must me not empty",
-						})
-		
-						return
-				}
+// apigenWriteValidationError responds with the first violation or,
+// for the endpoints annotated with "errors": "all", with all of them
+func apigenWriteValidationError(w http.ResponseWriter, err error, all bool) {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) == 0 {
+		apigenWriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !all {
+		apigenWriteError(w, http.StatusBadRequest, errs[0].Message)
+		return
+	}
 
-				`
-			}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(&struct {
+		Error  string           ` + "`json:\"error\"`" + `
+		Fields ValidationErrors ` + "`json:\"fields\"`" + `
+	}{
+		Error:  "validation failed",
+		Fields: errs,
+	})
+}
+{{- if .HasRateLimits}}
 
-			if strings.Contains(validation, "=") {
-				v := strings.Split(validation, "=")
+// apigenLimiter is a token bucket per key refilled with rate tokens a second
+type apigenLimiter struct {
+	rate  float64
+	burst int
 
-				if v[0] == "min" || v[0] == "max" {
-					var fieldLen string
-					var errMessage string
-					var validationExp string
+	mu      sync.Mutex
+	buckets map[string]*apigenBucket
+	swept   time.Time
+}
 
-					if v[0] == "min" {
-						validationExp = ">="
-					} else {
-						validationExp = "<="
-					}
+type apigenBucket struct {
+	tokens float64
+	last   time.Time
+}
 
-					switch field.FieldType {
-					case "int":
-						fieldLen = "fnParams." + field.FieldName
-						errMessage = strings.ToLower(field.FieldName) + " must be " + validationExp + " " + v[1]
-					case "string":
-						fieldLen = "len(fnParams." + field.FieldName + ")"
-						errMessage = strings.ToLower(field.FieldName) + " len must be " + validationExp + " " + v[1]
-					}
+// allow takes a token from the bucket of key, telling how long
+// to wait for the next one when there are none
+func (l *apigenLimiter) allow(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-					fieldsTmpl += `if ` + fieldLen + ` <= ` + v[1] + ` {
-						encoder := json.NewEncoder(w)
-		
-						w.WriteHeader(http.StatusBadRequest)
-		
-						_ = encoder.Encode(&struct{
-							Error string `+ "`" + `json:"error"` + "`" + `
-						}{
-							Error: "` + errMessage + "\"" +`,
-						})
-		
-						return
-				}
+	if l.buckets == nil {
+		l.buckets = make(map[string]*apigenBucket)
+	}
 
-				`
-				}
+	// forget the keys with refilled buckets now and then
+	if len(l.buckets) > 1024 && now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+				delete(l.buckets, k)
 			}
 		}
+		l.swept = now
 	}
 
-	return &ValidationTemplate{
-		ParamName: structContainer.Name,
-		Template: fieldsTmpl,
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &apigenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
 	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
 }
 
-var collectorInstance *Collector
-var once sync.Once
+// apigenRateKeyer can be implemented by an api with its own Authorize
+// to tell whose bucket an authorized request takes a token from
+type apigenRateKeyer interface {
+	RateKey(r *http.Request) string
+}
 
-func GetCollector() *Collector {
-	once.Do(func() {
-		collectorInstance = &Collector{}
-	})
-	return collectorInstance
+// apigenRateKey tells whose bucket the request takes a token from, the
+// "auth" key is asked for once the request is authorized; apis with their
+// own Authorize and no RateKey are limited by ip
+func apigenRateKey(srv interface{}, r *http.Request, key string) string {
+	if key == "auth" {
+		if k, ok := srv.(apigenRateKeyer); ok {
+			return "auth:" + k.RateKey(r)
+		}
+		if _, ok := srv.(apigenAuthorizer); !ok {
+			return "auth:" + r.Header.Get("X-Auth")
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
 }
 
-type Collector struct {
-	HandlerContainer []*HandlerContainer
-	StructContainer []*StructContainer
+func apigenWriteTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	apigenWriteError(w, http.StatusTooManyRequests, "too many requests")
 }
+{{- end}}
+{{- if .Metrics}}
 
-func visitor(node ast.Node) bool {
-	funcDecl, ok := node.(*ast.FuncDecl)
-	if ok {
-		doc := funcDecl.Doc
+// apigenStatusWriter remembers the status of the response for the metrics
+type apigenStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *apigenStatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
 
-		if doc != nil {
-			obj := &HandlerContainer{}
+func (w *apigenStatusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
 
-			obj.Param = funcDecl.Type.Params.List[1].Type.(*ast.Ident).String()
-			obj.StructMethod = funcDecl.Name.String()
+func (w *apigenStatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
 
-			if funcDecl.Recv != nil {
-				for _, v := range funcDecl.Recv.List {
-					starExpr := v.Type.(*ast.StarExpr)
+// apigenLatencyBuckets are the upper bounds of the latency histogram in seconds
+var apigenLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
 
-					if recv, ok := starExpr.X.(*ast.Ident); ok {
-						obj.Receiver = recv.Name
-					}
-				}
-			}
+// apigenMetricsRegistry holds the metrics of every endpoint in the package
+var apigenMetricsRegistry []*apigenEndpointMetrics
 
-			res := strings.Replace(doc.Text(), "apigen:api", "", -1)
+// apigenEndpointMetrics counts the requests of an endpoint, the errors
+// by status and the latency; labels are rendered from the annotation
+type apigenEndpointMetrics struct {
+	labels string
 
-			err := json.Unmarshal([]byte(res), obj)
-			if err != nil {
-				panic(err)
-			}
+	mu     sync.Mutex
+	values apigenMetricsValues
+}
 
-			collector := GetCollector()
-			collector.HandlerContainer = append(collector.HandlerContainer, obj)
+type apigenMetricsValues struct {
+	requests uint64
+	errors   map[int]uint64
+	buckets  []uint64
+	sum      float64
+}
+
+func apigenNewMetrics(labels string) *apigenEndpointMetrics {
+	m := &apigenEndpointMetrics{labels: labels}
+	apigenMetricsRegistry = append(apigenMetricsRegistry, m)
+	return m
+}
+
+func (m *apigenEndpointMetrics) observe(status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := &m.values
+	v.requests++
+	if status >= http.StatusBadRequest {
+		if v.errors == nil {
+			v.errors = make(map[int]uint64)
 		}
+		v.errors[status]++
 	}
 
-	currType, okSpec := node.(*ast.TypeSpec)
-	if okSpec {
+	if v.buckets == nil {
+		v.buckets = make([]uint64, len(apigenLatencyBuckets))
+	}
+	seconds := elapsed.Seconds()
+	for i, le := range apigenLatencyBuckets {
+		if seconds <= le {
+			v.buckets[i]++
+		}
+	}
+	v.sum += seconds
+}
 
-		structType, ok := currType.Type.(*ast.StructType)
-		if ok {
+// snapshot copies the values so they are written without the lock
+func (m *apigenEndpointMetrics) snapshot() apigenMetricsValues {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v := m.values
+	v.errors = make(map[int]uint64, len(m.values.errors))
+	for status, count := range m.values.errors {
+		v.errors[status] = count
+	}
+	v.buckets = make([]uint64, len(apigenLatencyBuckets))
+	copy(v.buckets, m.values.buckets)
+	return v
+}
 
-			structContainer := &StructContainer{}
+// apigenWriteMetrics writes the metrics of all the endpoints
+// in the Prometheus text exposition format
+func apigenWriteMetrics(w http.ResponseWriter) {
+	values := make([]apigenMetricsValues, len(apigenMetricsRegistry))
+	for i, m := range apigenMetricsRegistry {
+		values[i] = m.snapshot()
+	}
 
-			var showName = false
+	out := &bytes.Buffer{}
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
 
-			for _, str := range structType.Fields.List {
-				if str.Tag != nil {
-					if strings.Contains(str.Tag.Value, "apivalidator") {
-						showName = true
+	fmt.Fprintln(out, "# HELP apigen_requests_total Requests served by the endpoint.")
+	fmt.Fprintln(out, "# TYPE apigen_requests_total counter")
+	for i, m := range apigenMetricsRegistry {
+		fmt.Fprintf(out, "apigen_requests_total{%s} %d\n", m.labels, values[i].requests)
+	}
 
-						replacer := strings.NewReplacer("apivalidator:", "", "\"", "", "`", "")
+	fmt.Fprintln(out, "# HELP apigen_request_errors_total Requests answered with an error status.")
+	fmt.Fprintln(out, "# TYPE apigen_request_errors_total counter")
+	for i, m := range apigenMetricsRegistry {
+		var statuses []int
+		for status := range values[i].errors {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			fmt.Fprintf(out, "apigen_request_errors_total{%s,code=\"%d\"} %d\n", m.labels, status, values[i].errors[status])
+		}
+	}
 
-						validation := replacer.Replace(str.Tag.Value)
+	fmt.Fprintln(out, "# HELP apigen_request_duration_seconds Latency of the endpoint.")
+	fmt.Fprintln(out, "# TYPE apigen_request_duration_seconds histogram")
+	for i, m := range apigenMetricsRegistry {
+		v := values[i]
+		for j, le := range apigenLatencyBuckets {
+			fmt.Fprintf(out, "apigen_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", m.labels, formatFloat(le), v.buckets[j])
+		}
+		fmt.Fprintf(out, "apigen_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", m.labels, v.requests)
+		fmt.Fprintf(out, "apigen_request_duration_seconds_sum{%s} %s\n", m.labels, formatFloat(v.sum))
+		fmt.Fprintf(out, "apigen_request_duration_seconds_count{%s} %d\n", m.labels, v.requests)
+	}
 
-						structContainer.Fields = append(structContainer.Fields, &StructField{
-							FieldName:  str.Names[0].String(),
-							Validation: strings.Split(validation, ","),
-							FieldType: str.Type.(*ast.Ident).Name,
-						})
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(out.Bytes())
+}
 
-					}
+// MetricsHandler serves the metrics of all the endpoints like the apis
+// do on ` + metricsPath + `, for the apis mounted under a prefix
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apigenWriteMetrics(w)
+	})
+}
+{{- end}}
+{{- if .HasUploads}}
+
+// apigenMaxMemory is the part of a multipart body kept in memory,
+// the rest of the uploads is stored in temporary files
+const apigenMaxMemory = 32 << 20
+
+// apigenReadMultipart reads a multipart/form-data body of at most maxBody
+// bytes, the form is removed with its files once the method returns
+func apigenReadMultipart(w http.ResponseWriter, r *http.Request, maxBody int64) (*multipart.Form, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, apigenError{http.StatusUnsupportedMediaType, "unsupported content type"}
+	}
 
-				} else {
-					showName = false
-				}
-			}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	if err := r.ParseMultipartForm(apigenMaxMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, apigenError{http.StatusRequestEntityTooLarge, "request body too large"}
+		}
+		return nil, apigenError{http.StatusBadRequest, "bad multipart form"}
+	}
+	return r.MultipartForm, nil
+}
 
-			if showName {
-				structContainer.Name = currType.Name.String()
+// apigenFile is an uploaded file passed as io.Reader, it is opened
+// on the first read and closed by the handler
+type apigenFile struct {
+	header *multipart.FileHeader
+	file   multipart.File
+	err    error
+}
 
-				collector := GetCollector()
-				collector.StructContainer = append(collector.StructContainer, structContainer)
+func (f *apigenFile) Read(p []byte) (int, error) {
+	if f.file == nil && f.err == nil {
+		f.file, f.err = f.header.Open()
+	}
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.file.Read(p)
+}
 
-			}
+func (f *apigenFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+{{- end}}
+{{- if .HasResponse "raw"}}
+
+// apigenWriteReader copies the method result to the response as is,
+// closing it when it is an io.Closer
+func apigenWriteReader(w http.ResponseWriter, body io.Reader, contentType string) {
+	if body == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if closer, ok := body.(io.Closer); ok {
+		defer closer.Close()
+	}
 
-		}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("apigen: writing the response: %v", err)
+	}
+}
+{{- end}}
+{{- if .HasResponse "ndjson" "sse"}}
+
+// apigenStartStream writes the headers of a response streamed
+// as newline delimited JSON or as server-sent events
+func apigenStartStream(w http.ResponseWriter, sse bool) {
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = http.NewResponseController(w).Flush()
+}
 
+// apigenWriteEvent writes an item of a streamed response and flushes it
+func apigenWriteEvent(w http.ResponseWriter, item interface{}, sse bool) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		log.Printf("apigen: encoding a streamed item: %v", err)
+		return err
 	}
 
+	if sse {
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	} else {
+		_, err = w.Write(append(data, '\n'))
+	}
+	if err != nil {
+		return err
+	}
 
-	return true
-}
\ No newline at end of file
+	if err := http.NewResponseController(w).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+{{- end}}
+{{- if .Patterns}}
+
+var (
+	{{- range $i, $p := .Patterns}}
+	apigenPattern{{$i}} = regexp.MustCompile({{printf "%q" $p}})
+	{{- end}}
+)
+{{- end}}
+{{- if .Formats.email}}
+
+func apigenIsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+{{- end}}
+{{- if .Formats.url}}
+
+func apigenIsURL(s string) bool {
+	u, err := url.ParseRequestURI(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+{{- end}}
+`))
+
+// paramsTmpl renders the methods of a struct with apivalidator fields,
+// every field is checked in a func literal returning when it is missing
+// or can't be parsed, so the checks of the other rules are skipped
+var paramsTmpl = template.Must(template.New("params").Parse(`
+{{- if .JSONTypes}}
+
+// {{.JSONTypesVar}} are the types JSON bodies are checked against
+var {{.JSONTypesVar}} = map[string]string{
+	{{- range .JSONTypes}}
+	{{printf "%q" .Param}}: {{printf "%q" .Type}},
+	{{- end}}
+}
+{{- end}}
+{{- if .Local}}
+
+// FillFrom sets the fields of p from the query or form values
+// and checks them like Validate does
+func (p *{{.ParamName}}) FillFrom(q url.Values) error {
+	var errs ValidationErrors
+	{{.Fill}}
+	return {{.ValidateFunc}}(p, errs).orNil()
+}
+
+// Validate sets the defaults of empty fields and checks the apivalidator rules
+func (p *{{.ParamName}}) Validate() error {
+	return {{.ValidateFunc}}(p, nil).orNil()
+}
+{{- if .Files}}
+
+// FillFromMultipart sets the fields of p from a multipart form, the uploaded
+// files included, and checks them like Validate does
+func (p *{{.ParamName}}) FillFromMultipart(form *multipart.Form) error {
+	{{- template "multipart" .}}
+}
+{{- end}}
+{{- else}}
+
+// {{.FillFunc}} sets the fields of p from the query or form values
+// and checks them, methods can't be added to {{.ParamName}}
+func {{.FillFunc}}(p *{{.ParamName}}, q url.Values) error {
+	var errs ValidationErrors
+	{{.Fill}}
+	return {{.ValidateFunc}}(p, errs).orNil()
+}
+{{- if .Files}}
+
+// {{.MultipartFunc}} sets the fields of p from a multipart form,
+// the uploaded files included
+func {{.MultipartFunc}}(p *{{.ParamName}}, form *multipart.Form) error {
+	{{- template "multipart" .}}
+}
+{{- end}}
+{{- end}}
+
+// {{.ValidateFunc}} sets the defaults of empty fields and checks the rules,
+// the fields in errs failed to parse and are left unchecked
+func {{.ValidateFunc}}(p *{{.ParamName}}, errs ValidationErrors) ValidationErrors {
+	{{- .Validate}}
+	return errs
+}
+
+{{- define "multipart"}}
+	{{- if .Fill}}
+	q := url.Values(form.Value)
+	{{- end}}
+	files := form.File
+	var errs ValidationErrors
+	{{.Fill}}
+	{{.Files}}
+	return {{.ValidateFunc}}(p, errs).orNil()
+{{- end}}
+`))
+
+type ReceiverHandlers struct {
+	Receiver string
+	Handler  []*HandlerContainer
+}
+
+// receiverHandlers groups the handlers by receiver, sorting both by name
+func (c *Collector) receiverHandlers() []*ReceiverHandlers {
+	byReceiver := make(map[string]*ReceiverHandlers)
+	var receivers []*ReceiverHandlers
+
+	for _, handler := range c.HandlerContainer {
+		rh, ok := byReceiver[handler.Receiver]
+		if !ok {
+			rh = &ReceiverHandlers{Receiver: handler.Receiver}
+			byReceiver[handler.Receiver] = rh
+			receivers = append(receivers, rh)
+		}
+		rh.Handler = append(rh.Handler, handler)
+	}
+
+	sort.Slice(receivers, func(i, j int) bool {
+		return receivers[i].Receiver < receivers[j].Receiver
+	})
+	for _, rh := range receivers {
+		sortRoutes(rh.Handler)
+	}
+
+	return receivers
+}
+
+func RenderHTTPWrapper() ([]byte, error) {
+	container := GetCollector()
+
+	container.use("bytes", "encoding/json", "errors", "io", "io/ioutil", "log", "mime", "net/http", "net/url", "runtime/debug", "sort", "strconv", "strings", "sync")
+
+	receivers := container.receiverHandlers()
+
+	for _, rh := range receivers {
+		for _, handler := range rh.Handler {
+			container.use(container.typeImports(handler.ParamType)...)
+			if err := checkRoute(handler, handler.Struct); err != nil {
+				return nil, container.errorAt(handler.Pos, "%v", err)
+			}
+			if handler.Struct.HasFiles() && handler.Method != "POST" {
+				return nil, container.errorAt(handler.Pos, "%s receives files, it needs \"method\": \"POST\"", handler.StructMethod)
+			}
+			if handler.Timeout != "" {
+				container.use("context", "time")
+			}
+		}
+	}
+	if container.HasRateLimits() {
+		container.use("math", "net", "strconv", "sync", "time")
+	}
+	if container.HasUploads() {
+		container.use("mime/multipart")
+	}
+	if container.HasResponse("sse") {
+		container.use("fmt")
+	}
+	if container.Metrics {
+		container.use("fmt", "sort", "strconv", "sync", "time")
+	}
+
+	params := &bytes.Buffer{}
+	for _, structContainer := range container.StructContainer {
+		for _, method := range []string{"FillFrom", "Validate", "FillFromMultipart"} {
+			if method == "FillFromMultipart" && !structContainer.HasFiles() {
+				continue
+			}
+			if structContainer.Local && container.Methods[structContainer.Name+"."+method] {
+				return nil, container.errorAt(structContainer.Pos, "%s already has a %s method", structContainer.Name, method)
+			}
+		}
+		container.use(container.typeImports(structContainer.obj.Type())...)
+
+		if err := paramsTmpl.Execute(params, generateValidationCode(structContainer)); err != nil {
+			return nil, err
+		}
+	}
+
+	out := &bytes.Buffer{}
+
+	var serveHTTPTmpl = `
+		{{- $receiver := .Receiver}}
+		{{- range .Handler}}
+		{{- if metrics}}
+
+		var apigenMetrics{{$receiver}}{{.StructMethod}} = apigenNewMetrics({{printf "%q" .MetricLabels}})
+		{{- end}}
+		{{- if .Rate}}
+
+		var apigenLimiter{{$receiver}}{{.StructMethod}} = &apigenLimiter{rate: {{.RateLiteral}}, burst: {{.Burst}}}
+		{{- end}}
+		{{- if .IsPattern}}
+
+		var apigenRoute{{$receiver}}{{.StructMethod}} = []string{ {{- range $i, $s := .Segments}}{{if $i}}, {{end}}{{printf "%q" $s}}{{end -}} }
+		{{- end}}
+		{{- end}}
+
+		func (srv *{{.Receiver}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+			{{- template "dispatch" .Routes}}
+		}
+
+		{{- range .Handler}}
+
+		func (srv *{{.Receiver}}) handler{{.StructMethod}}(w http.ResponseWriter, r *http.Request, endpoint *Endpoint) {
+			{{- if .Method}}
+			if r.Method != {{printf "%q" .Method}} {
+				apigenWriteError(w, http.StatusNotAcceptable, "bad method")
+				return
+			}
+			{{- end}}
+
+			{{- if and .Rate (ne .RateKey "auth")}}
+			{{- template "rateLimit" .}}
+			{{- end}}
+
+			{{- if .Auth}}
+			if err := apigenAuthorize(srv, r); err != nil {
+				apigenWriteError(w, apigenErrorStatus(err, http.StatusForbidden), err.Error())
+				return
+			}
+			{{- end}}
+
+			{{- if and .Rate (eq .RateKey "auth")}}
+			{{- template "rateLimit" .}}
+			{{- end}}
+
+			{{- if .Struct.HasFiles}}
+
+			form, err := apigenReadMultipart(w, r, {{.MaxBody}})
+			if err != nil {
+				apigenWriteError(w, apigenErrorStatus(err, http.StatusBadRequest), err.Error())
+				return
+			}
+			defer form.RemoveAll()
+			{{- else}}
+
+			{{if .Struct.Fields}}q{{else}}_{{end}}, err := apigenReadParams(r, {{.MaxBody}}, {{if .Struct.Fields}}{{.Struct.JSONTypesVar}}{{else}}nil{{end}})
+			if err != nil {
+				apigenWriteError(w, apigenErrorStatus(err, http.StatusBadRequest), err.Error())
+				return
+			}
+			{{- end}}
+
+			fnParams := {{.Param}}{}
+			{{- if .Struct.Fields}}
+			{{- if .IsPattern}}
+			for name, values := range endpoint.PathParams {
+				{{if .Struct.HasFiles}}form.Value{{else}}q{{end}}[name] = values
+			}
+			{{- end}}
+			if err := {{template "fill" .Struct}}; err != nil {
+				apigenWriteValidationError(w, err, {{eq .Errors "all"}})
+				return
+			}
+			{{- range .Struct.Fields}}
+			{{- if eq .File "reader"}}
+			if f, ok := fnParams.{{.FieldName}}.(*apigenFile); ok {
+				defer f.Close()
+			}
+			{{- end}}
+			{{- end}}
+			{{- end}}
+			endpoint.Params = &fnParams
+
+			{{- if .Timeout}}
+
+			ctx, cancel := context.WithTimeout(r.Context(), {{.TimeoutLiteral}})
+			defer cancel()
+
+			res, err := srv.{{.StructMethod}}(ctx, fnParams)
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				apigenWriteError(w, http.StatusGatewayTimeout, "timeout")
+				return
+			}
+			{{- else}}
+
+			res, err := srv.{{.StructMethod}}(r.Context(), fnParams)
+			{{- end}}
+			if err != nil {
+				apigenWriteError(w, apigenErrorStatus(err, http.StatusInternalServerError), err.Error())
+				return
+			}
+			{{- if eq .Response "raw"}}
+
+			apigenWriteReader(w, res, {{printf "%q" .ContentType}})
+			{{- else if .IsStream}}
+
+			apigenStartStream(w, {{eq .Response "sse"}})
+			for {
+				select {
+				case <-{{if .Timeout}}ctx{{else}}r.Context(){{end}}.Done():
+					return
+				case item, ok := <-res:
+					if !ok {
+						return
+					}
+					if err := apigenWriteEvent(w, item, {{eq .Response "sse"}}); err != nil {
+						return
+					}
+				}
+			}
+			{{- else}}
+
+			apigenWriteResponse(w, res)
+			{{- end}}
+		}
+		{{- end}}
+	`
+
+	t := template.Must(template.New("funcTemp").Funcs(template.FuncMap{
+		"metricsPath": func() string { return metricsPath },
+		"metrics":     func() bool { return GetCollector().Metrics },
+		"hasStatic":   hasStatic,
+		"hasPatterns": hasPatterns,
+	}).Parse(serveHTTPTmpl + `
+		{{- define "rateLimit"}}
+			if wait, ok := apigenLimiter{{.Receiver}}{{.StructMethod}}.allow(apigenRateKey(srv, r, {{printf "%q" .RateKey}}), time.Now()); !ok {
+				apigenWriteTooManyRequests(w, wait)
+				return
+			}
+		{{- end}}
+		{{- define "fill" -}}
+		{{- if .HasFiles}}
+		{{- if .Local}}fnParams.FillFromMultipart(form){{else}}{{.MultipartFunc}}(&fnParams, form){{end}}
+		{{- else}}
+		{{- if .Local}}fnParams.FillFrom(q){{else}}{{.FillFunc}}(&fnParams, q){{end}}
+		{{- end}}
+		{{- end}}
+		{{- define "dispatch"}}
+			{{- if or (hasStatic .) metrics}}
+			switch r.URL.Path {
+			{{- if metrics}}
+			case {{printf "%q" metricsPath}}:
+				apigenWriteMetrics(w)
+				return
+			{{- end}}
+			{{- range .}}
+			{{- if not .IsPattern}}
+			case {{printf "%q" .Path}}:
+				apigenServe({{.Srv}}, w, r, {{template "endpoint" .}}, {{.Srv}}.handler{{.StructMethod}})
+				return
+			{{- end}}
+			{{- end}}
+			}
+			{{- end}}
+
+			{{- if hasPatterns .}}
+
+			segments := apigenSplitPath(r.URL.EscapedPath())
+			{{- range .}}
+			{{- if .IsPattern}}
+			if pathParams, ok := apigenMatchPath(segments, {{.Var}}, {{range $i, $p := .PathParams}}{{if $i}}, {{end}}{{printf "%q" $p}}{{end}}); ok {
+				endpoint := {{template "endpoint" .}}
+				endpoint.PathParams = pathParams
+				apigenServe({{.Srv}}, w, r, endpoint, {{.Srv}}.handler{{.StructMethod}})
+				return
+			}
+			{{- end}}
+			{{- end}}
+			{{- end}}
+
+			apigenWriteError(w, http.StatusNotFound, "unknown method")
+		{{- end}}
+		{{- define "endpoint" -}}
+		&Endpoint{Receiver: {{printf "%q" .Receiver}}, Name: {{printf "%q" .StructMethod}}, Method: {{printf "%q" .Method}}, URL: {{printf "%q" .Url}}
+		{{- if metrics}}, metrics: apigenMetrics{{.Receiver}}{{.StructMethod}}{{end}}}
+		{{- end}}
+	`))
+
+	router := template.Must(t.New("router").Parse(routerTmpl))
+
+	body := &bytes.Buffer{}
+	for _, rh := range receivers {
+		if err := t.Execute(body, rh); err != nil {
+			return nil, err
+		}
+	}
+	if len(container.Services) > 0 {
+		err := router.Execute(body, map[string]interface{}{
+			"Services": container.Services,
+			"Routes":   container.routerRoutes(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := helpersTmpl.Execute(out, container); err != nil {
+		return nil, err
+	}
+	out.Write(params.Bytes())
+	out.Write(body.Bytes())
+
+	return renderGoFile(container.Package, container.importList(), out.Bytes())
+}
+
+// renderGoFile puts the generated header, package clause and imports
+// in front of the code and formats the result
+func renderGoFile(pkg string, imports []string, code []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+
+	fmt.Fprintln(out, generatedHeader)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "package", pkg)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "import (")
+	for _, spec := range imports {
+		if name, path, ok := strings.Cut(spec, " "); ok {
+			fmt.Fprintf(out, "\t%s %q\n", name, path)
+			continue
+		}
+		fmt.Fprintf(out, "\t%q\n", spec)
+	}
+	fmt.Fprintln(out, ")")
+	out.Write(code)
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "generated code is invalid")
+	}
+
+	return src, nil
+}
+
+type HandlerContainer struct {
+	Url          string
+	Auth         bool
+	Method       string
+	Param        string
+	Receiver     string
+	StructMethod string
+	Result       string
+	MaxBody      int64  `json:"max_body"`
+	Errors       string `json:"errors"`
+
+	Timeout       string        `json:"timeout"`
+	TimeoutValue  time.Duration `json:"-"`
+	Rate          string        `json:"rate"`
+	RatePerSecond float64       `json:"-"`
+	Burst         int           `json:"burst"`
+	RateKey       string        `json:"rate_key"`
+
+	Response    string `json:"response"`
+	ContentType string `json:"content_type"`
+	StreamElem  string `json:"-"`
+
+	Struct     *StructContainer `json:"-"`
+	ParamType  *types.Named     `json:"-"`
+	ResultType types.Type       `json:"-"`
+	Pos        token.Pos        `json:"-"`
+	ParamPos   token.Pos        `json:"-"`
+}
+
+type StructContainer struct {
+	Name   string
+	Fields []*StructField
+	Pos    token.Pos
+
+	// Local tells whether the struct belongs to the generated package,
+	// params of other packages are filled by functions instead of methods
+	Local bool
+
+	obj *types.TypeName
+}
+
+// FillFunc names the function filling params of another package
+func (s *StructContainer) FillFunc() string {
+	pkg := s.obj.Pkg().Name()
+	return "apigenFill" + strings.ToUpper(pkg[:1]) + pkg[1:] + s.obj.Name()
+}
+
+// ValidateFunc names the function checking the rules of the params
+func (s *StructContainer) ValidateFunc() string {
+	if s.Local {
+		return "apigenValidate" + s.obj.Name()
+	}
+	return strings.Replace(s.FillFunc(), "apigenFill", "apigenValidate", 1)
+}
+
+// JSONTypesVar names the var holding the types of the params in JSON bodies
+func (s *StructContainer) JSONTypesVar() string {
+	if s.Local {
+		return "apigenJSONTypes" + s.obj.Name()
+	}
+	return strings.Replace(s.FillFunc(), "apigenFill", "apigenJSONTypes", 1)
+}
+
+type StructField struct {
+	FieldName  string
+	FieldType  string
+	Validation []string
+	Pos        token.Pos
+
+	// BaseType is the underlying type of ElemType, the type behind the
+	// pointer or slice; named types are validated like their underlying one
+	BaseType string
+	ElemType string
+	Pointer  bool
+	Slice    bool
+	Nested   string
+	Embedded bool
+
+	elemPkg *types.Package
+	nested  *types.TypeName
+
+	ParamName  string
+	Required   bool
+	Enum       []string
+	Default    string
+	HasDefault bool
+	Min        string
+	Max        string
+	Len        string
+	Pattern    string
+	Format     string
+	Path       bool
+
+	// File is set for uploaded files, "header" for *multipart.FileHeader
+	// and "reader" for io.Reader fields; MaxSize limits them in bytes
+	File    string
+	MaxSize string
+
+	// Compare holds the rules checked against other fields of the struct
+	// once all of them are filled
+	Compare []*FieldRule
+
+	// Order is the position of the field in the struct, violations are
+	// reported in it; CrossOrder places the cross-field ones after them
+	Order      int
+	CrossOrder int
+}
+
+// violation is a broken rule rendered by the badRequest template
+type violation struct {
+	Field   *StructField
+	Rule    string
+	Message string
+	Order   int
+}
+
+// FieldRule is a cross-field rule like gtfield=StartAge or
+// required_if=Status admin
+type FieldRule struct {
+	Rule  string
+	Field string
+	Value string
+	Other *StructField
+}
+
+// compareOps maps the cross-field rules to the operators named in errors
+var compareOps = map[string]string{
+	"gtfield":  ">",
+	"gtefield": ">=",
+	"ltfield":  "<",
+	"ltefield": "<=",
+	"eqfield":  "==",
+	"nefield":  "!=",
+}
+
+// uuidPattern is checked by the uuid rule
+const uuidPattern = `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
+
+type ValidationTemplate struct {
+	ParamName     string
+	Local         bool
+	FillFunc      string
+	MultipartFunc string
+	ValidateFunc  string
+	JSONTypesVar  string
+	JSONTypes     []JSONType
+	Fill          string
+	Validate      string
+	Files         string
+}
+
+// JSONType is the type of a param in a JSON body, like int or []string
+type JSONType struct {
+	Param string
+	Type  string
+}
+
+// resolveParams returns the params struct with the fields of nested and
+// embedded structs flattened into it in declaration order; nested params
+// are named with dots, like address.city
+func (c *Collector) resolveParams(obj *types.TypeName, pos token.Pos) (*StructContainer, error) {
+	fields, err := c.flattenFields(obj, "", "", pos, map[*types.TypeName]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	structContainer := c.structFields(obj)
+	return &StructContainer{
+		Name:   structContainer.Name,
+		Fields: fields,
+		Pos:    structContainer.Pos,
+		Local:  structContainer.Local,
+		obj:    obj,
+	}, nil
+}
+
+func (c *Collector) flattenFields(obj *types.TypeName, selector, param string, pos token.Pos, seen map[*types.TypeName]bool) ([]*StructField, error) {
+	if seen[obj] {
+		return nil, c.errorAt(pos, "%s: recursive params struct", obj.Name())
+	}
+	seen[obj] = true
+	defer delete(seen, obj)
+
+	var fields []*StructField
+	siblings := make(map[string]*StructField)
+	for _, field := range c.structFields(obj).Fields {
+		if field.Nested == "" {
+			flat := *field
+			flat.FieldName = selector + field.FieldName
+			flat.ParamName = param + field.ParamName
+			fields = append(fields, &flat)
+			siblings[field.FieldName] = &flat
+			continue
+		}
+
+		nestedParam := param + field.ParamName + "."
+		if field.Embedded {
+			nestedParam = param
+		}
+
+		nested, err := c.flattenFields(field.nested, selector+field.FieldName+".", nestedParam, field.Pos, seen)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, nested...)
+	}
+
+	for _, field := range fields {
+		if _, ok := siblings[strings.TrimPrefix(field.FieldName, selector)]; !ok {
+			continue
+		}
+
+		rules := field.Compare
+		field.Compare = nil
+		for _, rule := range rules {
+			resolved := *rule
+			resolved.Other = siblings[rule.Field]
+			if err := checkFieldRule(field, &resolved); err != nil {
+				return nil, c.errorAt(field.Pos, "%s.%s: %v", obj.Name(), strings.TrimPrefix(field.FieldName, selector), err)
+			}
+			field.Compare = append(field.Compare, &resolved)
+		}
+	}
+
+	return fields, nil
+}
+
+// checkFieldRule verifies that the fields compared by a cross-field rule
+// exist and have types the rule can be applied to
+func checkFieldRule(field *StructField, rule *FieldRule) error {
+	other := rule.Other
+	if other == nil {
+		return errors.Errorf("%s: no field %s", rule.Rule, rule.Field)
+	}
+	if other.File != "" {
+		return errors.Errorf("%s can't refer to the file %s", rule.Rule, rule.Field)
+	}
+
+	if rule.Rule == "required_if" {
+		if other.Slice || other.BaseType == "time.Time" {
+			return errors.Errorf("%s: %s can't be compared with a value", rule.Rule, other.FieldType)
+		}
+		return checkLiteral(other, rule.Value)
+	}
+
+	if field.Pointer || field.Slice || other.Pointer || other.Slice {
+		return errors.Errorf("%s is not supported for pointers and slices", rule.Rule)
+	}
+	if field.ElemType != other.ElemType {
+		return errors.Errorf("%s: %s can't be compared with %s", rule.Rule, field.FieldType, other.FieldType)
+	}
+	if (field.BaseType == "string" || field.BaseType == "bool") && rule.Rule != "eqfield" && rule.Rule != "nefield" {
+		return errors.Errorf("%s is not supported for %s", rule.Rule, field.BaseType)
+	}
+
+	return nil
+}
+
+// fieldParsers holds the call and the conversion used to decode
+// a single query value into a field of the given type
+var fieldParsers = map[string]struct {
+	Parse   string
+	Convert string
+	Import  string
+}{
+	"int":       {"strconv.Atoi(raw)", "v", "strconv"},
+	"int64":     {"strconv.ParseInt(raw, 10, 64)", "v", "strconv"},
+	"uint":      {"strconv.ParseUint(raw, 10, 0)", "uint(v)", "strconv"},
+	"float64":   {"strconv.ParseFloat(raw, 64)", "v", "strconv"},
+	"bool":      {"strconv.ParseBool(raw)", "v", "strconv"},
+	"time.Time": {"time.Parse(time.RFC3339, raw)", "v", "time"},
+}
+
+var fieldValidationTmpl = template.Must(template.New("fieldValidation").Funcs(template.FuncMap{
+	"literal": literal,
+	"empty":   emptyCheck,
+	"join":    strings.Join,
+	"fail": func(field *StructField, rule, message string) interface{} {
+		return violation{field, rule, message, field.Order}
+	},
+	"crossFail": func(field *StructField, rule, message string) interface{} {
+		return violation{field, rule, message, field.CrossOrder}
+	},
+	// stops tells whether the other rules of the field are left unchecked
+	// after the rule is broken
+	"stops": func(rule string) bool {
+		return rule == "required" || rule == "type" || rule == "maxsize"
+	},
+	"checks": func(field *StructField, value string) interface{} {
+		return struct {
+			Field *StructField
+			Value string
+		}{field, value}
+	},
+	"parser": func(fieldType string) interface{} {
+		GetCollector().use(fieldParsers[fieldType].Import)
+		return fieldParsers[fieldType]
+	},
+	"pattern": func(expr string) string {
+		return GetCollector().pattern(expr)
+	},
+	"format": func(format string) string {
+		return GetCollector().format(format)
+	},
+	"violates":    violates,
+	"uuidPattern": func() string { return uuidPattern },
+	"op": func(rule string) string {
+		return compareOps[rule]
+	},
+	"elem": func(field *StructField) string {
+		GetCollector().use(GetCollector().importSpec(field.elemPkg))
+		return field.ElemType
+	},
+	"conv": func(field *StructField, value string) string {
+		if field.ElemType == field.BaseType {
+			return value
+		}
+		GetCollector().use(GetCollector().importSpec(field.elemPkg))
+		return field.ElemType + "(" + value + ")"
+	},
+	"str": func(field *StructField, value string) string {
+		if field.ElemType == field.BaseType {
+			return value
+		}
+		return "string(" + value + ")"
+	},
+}).Parse(`
+	{{- define "badRequest"}}
+		errs = errs.add(&ValidationError{
+			Field:   {{printf "%q" .Field.FieldName}},
+			Param:   {{printf "%q" .Field.ParamName}},
+			Rule:    {{printf "%q" .Rule}},
+			Message: {{printf "%q" .Message}},
+			order:   {{.Order}},
+		})
+		{{- if stops .Rule}}
+		return
+		{{- end}}
+	{{- end}}
+
+	{{- define "valueChecks"}}
+	{{- $f := .Field}}
+	{{- if $f.Enum}}
+	switch {{.Value}} {
+	case {{range $i, $v := $f.Enum}}{{if $i}}, {{end}}{{literal $f $v}}{{end}}:
+	default:
+		{{- template "badRequest" fail $f "enum" (printf "%s must be one of [%s]" $f.ParamName (join $f.Enum ", "))}}
+	}
+	{{- end}}
+	{{- if $f.Pattern}}
+	if {{.Value}} != "" && !{{pattern $f.Pattern}}.MatchString({{str $f .Value}}) {
+		{{- template "badRequest" fail $f "pattern" (printf "%s must match %s" $f.ParamName $f.Pattern)}}
+	}
+	{{- end}}
+	{{- if eq $f.Format "uuid"}}
+	if {{.Value}} != "" && !{{pattern uuidPattern}}.MatchString({{str $f .Value}}) {
+		{{- template "badRequest" fail $f "uuid" (printf "%s must be uuid" $f.ParamName)}}
+	}
+	{{- else if $f.Format}}
+	if {{.Value}} != "" && !{{format $f.Format}}({{str $f .Value}}) {
+		{{- template "badRequest" fail $f $f.Format (printf "%s must be %s" $f.ParamName $f.Format)}}
+	}
+	{{- end}}
+	{{- if not $f.Slice}}
+	{{- $length := .Value}}
+	{{- $what := "must be"}}
+	{{- if eq $f.BaseType "string"}}
+		{{- $length = printf "len(%s)" .Value}}
+		{{- $what = "len must be"}}
+	{{- end}}
+	{{- if $f.Min}}
+	if {{$length}} < {{$f.Min}} {
+		{{- template "badRequest" fail $f "min" (printf "%s %s >= %s" $f.ParamName $what $f.Min)}}
+	}
+	{{- end}}
+	{{- if $f.Max}}
+	if {{$length}} > {{$f.Max}} {
+		{{- template "badRequest" fail $f "max" (printf "%s %s <= %s" $f.ParamName $what $f.Max)}}
+	}
+	{{- end}}
+	{{- if $f.Len}}
+	if {{$length}} != {{$f.Len}} {
+		{{- template "badRequest" fail $f "len" (printf "%s len must be %s" $f.ParamName $f.Len)}}
+	}
+	{{- end}}
+	{{- end}}
+	{{- end}}
+
+	{{- define "crossChecks"}}
+	{{- $f := .}}
+	{{- $value := printf "p.%s" .FieldName}}
+	{{- range .Compare}}
+	{{- $other := printf "p.%s" .Other.FieldName}}
+	{{- if eq .Rule "required_if"}}
+	if {{if .Other.Pointer}}{{$other}} != nil && *{{end}}{{$other}} == {{literal .Other .Value}} && {{empty $f $value}} {
+		{{- template "badRequest" crossFail $f .Rule (printf "%s must me not empty when %s is %s" $f.ParamName .Other.ParamName .Value)}}
+	}
+	{{- else}}
+	if {{violates .Rule $f.BaseType $value $other}} {
+		{{- template "badRequest" crossFail $f .Rule (printf "%s must be %s %s" $f.ParamName (op .Rule) .Other.ParamName)}}
+	}
+	{{- end}}
+	{{- end}}
+	{{- end}}
+
+	{{- define "fileFill"}}
+	{{- $value := printf "p.%s" .FieldName}}
+	{{$value}} = nil
+	if headers := files[{{printf "%q" .ParamName}}]; len(headers) > 0 {
+		{{- if .MaxSize}}
+		if headers[0].Size > {{.MaxSize}} {
+			{{- template "badRequest" fail . "maxsize" (printf "%s must be at most %s bytes" .ParamName .MaxSize)}}
+		}
+		{{- end}}
+		{{- if eq .File "reader"}}
+		{{$value}} = &apigenFile{header: headers[0]}
+		{{- else}}
+		{{$value}} = headers[0]
+		{{- end}}
+	}
+	{{- end}}
+
+	{{- define "fileChecks"}}
+	{{- $value := printf "p.%s" .FieldName}}
+	{{- template "parsed" .}}
+	{{- if .Required}}
+	if {{$value}} == nil {
+		{{- template "badRequest" fail . "required" (printf "%s must me not empty" .ParamName)}}
+	}
+	{{- end}}
+	{{- if and .MaxSize (eq .File "header")}}
+	if {{$value}} != nil && {{$value}}.Size > {{.MaxSize}} {
+		{{- template "badRequest" fail . "maxsize" (printf "%s must be at most %s bytes" .ParamName .MaxSize)}}
+	}
+	{{- end}}
+	{{- end}}
+
+	{{- define "decode"}}
+	{{- $value := printf "p.%s" .FieldName}}
+	{{- $name := printf "%q" .ParamName}}
+
+	{{- if .Slice}}
+	{{- if eq .ElemType "string"}}
+	{{$value}} = q[{{$name}}]
+	{{- else if eq .BaseType "string"}}
+	{{$value}} = nil
+	for _, raw := range q[{{$name}}] {
+		{{$value}} = append({{$value}}, {{conv . "raw"}})
+	}
+	{{- else}}
+	{{- $parser := parser .BaseType}}
+	{{$value}} = nil
+	for _, raw := range q[{{$name}}] {
+		v, err := {{$parser.Parse}}
+		if err != nil {
+			{{- template "badRequest" fail . "type" (printf "%s must be %s" .ParamName .FieldType)}}
+		}
+		{{$value}} = append({{$value}}, {{conv . $parser.Convert}})
+	}
+	{{- end}}
+	{{- else if .Pointer}}
+	if raws, ok := q[{{$name}}]; ok {
+		raw := raws[0]
+		{{- if eq .ElemType "string"}}
+		{{$value}} = &raw
+		{{- else if eq .BaseType "string"}}
+		v := {{conv . "raw"}}
+		{{$value}} = &v
+		{{- else}}
+		{{- $parser := parser .BaseType}}
+		v, err := {{$parser.Parse}}
+		if err != nil {
+			{{- template "badRequest" fail . "type" (printf "%s must be %s" .ParamName .BaseType)}}
+		}
+		{{$value}} = new({{elem .}})
+		*{{$value}} = {{conv . $parser.Convert}}
+		{{- end}}
+	}
+	{{- else if eq .BaseType "string"}}
+	{{$value}} = {{conv . (printf "q.Get(%s)" $name)}}
+	{{- else}}
+	{{- $parser := parser .BaseType}}
+	if raw := q.Get({{$name}}); raw != "" {
+		v, err := {{$parser.Parse}}
+		if err != nil {
+			{{- template "badRequest" fail . "type" (printf "%s must be %s" .ParamName .BaseType)}}
+		}
+		{{$value}} = {{conv . $parser.Convert}}
+	}
+	{{- end}}
+	{{- end}}
+
+	{{- define "parsed"}}
+	if errs.has({{printf "%q" .FieldName}}) {
+		return
+	}
+	{{- end}}
+
+	{{- define "checks"}}
+	{{- $value := printf "p.%s" .FieldName}}
+	{{- $empty := empty . $value}}
+	{{- template "parsed" .}}
+
+	{{- if .HasDefault}}
+	if {{$empty}} {
+		{{- if .Pointer}}
+		{{$value}} = new({{elem .}})
+		*{{$value}} = {{literal . .Default}}
+		{{- else}}
+		{{$value}} = {{literal . .Default}}
+		{{- end}}
+	}
+	{{- end}}
+
+	{{- if .Required}}
+	if {{$empty}} {
+		{{- template "badRequest" fail . "required" (printf "%s must me not empty" .ParamName)}}
+	}
+	{{- end}}
+
+	{{- if .Slice}}
+	{{- if or .Enum .Pattern .Format}}
+	for _, v := range {{$value}} {
+		{{- template "valueChecks" checks . "v"}}
+	}
+	{{- end}}
+	{{- if .Min}}
+	if len({{$value}}) < {{.Min}} {
+		{{- template "badRequest" fail . "min" (printf "%s len must be >= %s" .ParamName .Min)}}
+	}
+	{{- end}}
+	{{- if .Max}}
+	if len({{$value}}) > {{.Max}} {
+		{{- template "badRequest" fail . "max" (printf "%s len must be <= %s" .ParamName .Max)}}
+	}
+	{{- end}}
+	{{- if .Len}}
+	if len({{$value}}) != {{.Len}} {
+		{{- template "badRequest" fail . "len" (printf "%s len must be %s" .ParamName .Len)}}
+	}
+	{{- end}}
+	{{- else if .Pointer}}
+	{{- if or .Enum .Min .Max .Len .Pattern .Format}}
+	if {{$value}} != nil {
+		{{- template "valueChecks" checks . (printf "*%s" $value)}}
+	}
+	{{- end}}
+	{{- else}}
+	{{- template "valueChecks" checks . $value}}
+	{{- end}}
+	{{- end}}
+`))
+
+// literal renders a tag value as a Go literal of the field type;
+// the zero value is returned for an empty value
+func literal(field *StructField, value string) string {
+	switch field.BaseType {
+	case "string":
+		return strconv.Quote(value)
+	case "bool":
+		if value == "" {
+			return "false"
+		}
+	default:
+		if value == "" {
+			return "0"
+		}
+	}
+
+	return value
+}
+
+// violates renders the condition telling that a and b break
+// the cross-field rule, time.Time values are compared with their methods
+func violates(rule, baseType, a, b string) string {
+	if baseType == "time.Time" {
+		return fmt.Sprintf(map[string]string{
+			"gtfield":  "!%[1]s.After(%[2]s)",
+			"gtefield": "%[1]s.Before(%[2]s)",
+			"ltfield":  "!%[1]s.Before(%[2]s)",
+			"ltefield": "%[1]s.After(%[2]s)",
+			"eqfield":  "!%[1]s.Equal(%[2]s)",
+			"nefield":  "%[1]s.Equal(%[2]s)",
+		}[rule], a, b)
+	}
+
+	negated := map[string]string{
+		"gtfield":  "<=",
+		"gtefield": "<",
+		"ltfield":  ">=",
+		"ltefield": ">",
+		"eqfield":  "!=",
+		"nefield":  "==",
+	}
+	return a + " " + negated[rule] + " " + b
+}
+
+// emptyCheck renders the condition telling that the field value is
+// absent: nil pointers, empty slices and zero values otherwise
+func emptyCheck(field *StructField, value string) string {
+	switch {
+	case field.Slice:
+		return "len(" + value + ") == 0"
+	case field.Pointer:
+		return value + " == nil"
+	case field.BaseType == "time.Time":
+		return value + ".IsZero()"
+	}
+	return value + " == " + literal(field, "")
+}
+
+// checkLiteral reports whether value can be assigned to the field
+func checkLiteral(field *StructField, value string) error {
+	var err error
+
+	switch field.BaseType {
+	case "string":
+	case "int", "int64":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "uint":
+		_, err = strconv.ParseUint(value, 10, 64)
+	case "float64":
+		_, err = strconv.ParseFloat(value, 64)
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	}
+
+	if err != nil {
+		return errors.Errorf("%q is not a valid %s value", value, field.BaseType)
+	}
+
+	return nil
+}
+
+// generateValidationCode renders the decoding of the fields done by FillFrom
+// and the checks shared by FillFrom and Validate, cross-field rules
+// are checked once all the fields are set; uploaded files are only
+// filled from multipart forms
+func generateValidationCode(structContainer *StructContainer) *ValidationTemplate {
+	fill := &bytes.Buffer{}
+	validate := &bytes.Buffer{}
+	files := &bytes.Buffer{}
+
+	execute := func(code *bytes.Buffer, name string, field *StructField) {
+		checks := &bytes.Buffer{}
+		if err := fieldValidationTmpl.ExecuteTemplate(checks, name, field); err != nil {
+			log.Fatal(err)
+		}
+		body := strings.TrimRight(checks.String(), "\n\t ")
+		parsed := &bytes.Buffer{}
+		if err := fieldValidationTmpl.ExecuteTemplate(parsed, "parsed", field); err != nil {
+			log.Fatal(err)
+		}
+		if body == strings.TrimRight(parsed.String(), "\n\t ") {
+			// the field has nothing to check once parsed
+			body = ""
+		}
+		switch {
+		case strings.Contains(body, "return"):
+			// the func literal ends the checks of the field
+			fmt.Fprintf(code, "\nfunc() {%s\n}()\n", body)
+		case body != "":
+			fmt.Fprintf(code, "%s\n", body)
+		}
+	}
+
+	for i, field := range structContainer.Fields {
+		field.Order = i
+		field.CrossOrder = len(structContainer.Fields) + i
+	}
+
+	for _, field := range structContainer.Fields {
+		if field.File != "" {
+			execute(files, "fileFill", field)
+			execute(validate, "fileChecks", field)
+			continue
+		}
+		execute(fill, "decode", field)
+		execute(validate, "checks", field)
+	}
+	for _, field := range structContainer.Fields {
+		if len(field.Compare) > 0 {
+			execute(validate, "crossChecks", field)
+		}
+	}
+
+	var jsonTypes []JSONType
+	if !structContainer.HasFiles() {
+		for _, field := range structContainer.Fields {
+			typ := field.BaseType
+			if field.Slice {
+				typ = "[]" + typ
+			}
+			jsonTypes = append(jsonTypes, JSONType{Param: field.ParamName, Type: typ})
+		}
+	}
+
+	return &ValidationTemplate{
+		ParamName:     structContainer.Name,
+		Local:         structContainer.Local,
+		FillFunc:      structContainer.FillFunc(),
+		MultipartFunc: structContainer.MultipartFunc(),
+		ValidateFunc:  structContainer.ValidateFunc(),
+		JSONTypesVar:  structContainer.JSONTypesVar(),
+		JSONTypes:     jsonTypes,
+		Fill:          fill.String(),
+		Validate:      validate.String(),
+		Files:         files.String(),
+	}
+}
+
+// validationRules are the apivalidator rule names
+var validationRules = map[string]bool{
+	"required": true, "paramname": true, "enum": true, "oneof": true, "default": true,
+	"min": true, "max": true, "len": true, "pattern": true, "email": true, "url": true, "uuid": true,
+	"gtfield": true, "gtefield": true, "ltfield": true, "ltefield": true, "eqfield": true, "nefield": true,
+	"required_if": true, "path": true, "maxsize": true,
+}
+
+// parseValidation fills the field rules from the comma separated
+// apivalidator tag, e.g. `apivalidator:"enum=user|admin,default=user"`
+func parseValidation(field *StructField) error {
+	field.ParamName = strings.ToLower(field.FieldName)
+
+	for i, validation := range field.Validation {
+		if validation == "" {
+			continue
+		}
+
+		rule := strings.SplitN(validation, "=", 2)
+		name, value := rule[0], ""
+		if len(rule) == 2 {
+			value = rule[1]
+		}
+
+		if name == "pattern" {
+			// the regexp takes the rest of the tag as it may contain commas,
+			// so a rule after it would silently become a part of the regexp
+			for _, next := range field.Validation[i+1:] {
+				if rule := strings.SplitN(next, "=", 2)[0]; validationRules[rule] {
+					return errors.Errorf("pattern must be the last rule, %s follows it", rule)
+				}
+			}
+			field.Pattern = strings.Join(append([]string{value}, field.Validation[i+1:]...), ",")
+			if _, err := regexp.Compile(field.Pattern); err != nil {
+				return errors.Wrap(err, "pattern")
+			}
+			break
+		}
+
+		switch name {
+		case "required":
+			field.Required = true
+		case "paramname":
+			field.ParamName = value
+		case "enum":
+			field.Enum = strings.Split(value, "|")
+		case "oneof":
+			field.Enum = strings.FieldsFunc(value, func(r rune) bool {
+				return r == ' ' || r == '|'
+			})
+		case "default":
+			field.Default = value
+			field.HasDefault = true
+		case "min":
+			field.Min = value
+		case "max":
+			field.Max = value
+		case "len":
+			field.Len = value
+		case "email", "url", "uuid":
+			field.Format = name
+		case "gtfield", "gtefield", "ltfield", "ltefield", "eqfield", "nefield":
+			if value == "" {
+				return errors.Errorf("%s needs a field name", name)
+			}
+			field.Compare = append(field.Compare, &FieldRule{Rule: name, Field: value})
+		case "required_if":
+			parts := strings.Fields(value)
+			if len(parts) != 2 {
+				return errors.Errorf("required_if=%s must be a field name and a value", value)
+			}
+			field.Compare = append(field.Compare, &FieldRule{Rule: name, Field: parts[0], Value: parts[1]})
+		case "path":
+			field.Path = true
+		case "maxsize":
+			if field.File == "" {
+				return errors.New("maxsize is only supported for files")
+			}
+			size, err := parseSize(value)
+			if err != nil {
+				return err
+			}
+			field.MaxSize = size
+		default:
+			return errors.Errorf("unknown apivalidator rule %q", name)
+		}
+
+		if name == "min" || name == "max" || name == "len" {
+			if _, err := strconv.Atoi(value); err != nil && (name == "len" || field.BaseType != "float64") {
+				return errors.Errorf("%s=%s is not an integer", name, value)
+			}
+		}
+	}
+
+	if field.File != "" {
+		if field.HasDefault || field.Path || len(field.Enum) > 0 || field.Min != "" || field.Max != "" ||
+			field.Len != "" || field.Pattern != "" || field.Format != "" || len(field.Compare) > 0 {
+			return errors.New("only required, paramname and maxsize are supported for files")
+		}
+		return nil
+	}
+
+	if field.Nested != "" {
+		if field.Required || field.HasDefault || field.Path || len(field.Enum) > 0 || field.Min != "" || field.Max != "" ||
+			field.Len != "" || field.Pattern != "" || field.Format != "" || len(field.Compare) > 0 {
+			return errors.Errorf("only paramname is supported for the nested struct %s", field.Nested)
+		}
+		return nil
+	}
+
+	switch field.BaseType {
+	case "string", "int", "int64", "uint", "float64":
+	case "bool":
+		// default is applied to zero values, so false could never be passed
+		// unless the field is a pointer
+		if field.Min != "" || field.Max != "" || len(field.Enum) > 0 || field.HasDefault && !field.Pointer {
+			return errors.New("min, max, enum and default are not supported for bool")
+		}
+	case "time.Time":
+		if field.Min != "" || field.Max != "" || len(field.Enum) > 0 || field.HasDefault {
+			return errors.New("min, max, enum and default are not supported for time.Time")
+		}
+	default:
+		return errors.Errorf("unsupported type %s", field.FieldType)
+	}
+
+	if field.Slice && (field.HasDefault || field.Path) {
+		return errors.Errorf("default and path are not supported for %s", field.FieldType)
+	}
+	if field.Len != "" && field.BaseType != "string" && !field.Slice {
+		return errors.Errorf("len is not supported for %s", field.FieldType)
+	}
+	if (field.Pattern != "" || field.Format != "") && field.BaseType != "string" {
+		return errors.Errorf("pattern, email, url and uuid are not supported for %s", field.FieldType)
+	}
+
+	values := append([]string{}, field.Enum...)
+	if field.HasDefault {
+		values = append(values, field.Default)
+	}
+	if field.BaseType == "float64" {
+		values = append(values, field.Min, field.Max)
+	}
+	for _, value := range values {
+		if value == "" && field.BaseType == "float64" {
+			continue
+		}
+		if err := checkLiteral(field, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var collectorInstance *Collector
+var once sync.Once
+
+func GetCollector() *Collector {
+	once.Do(func() {
+		collectorInstance = &Collector{}
+	})
+	return collectorInstance
+}
+
+type Collector struct {
+	Package          string
+	HasApiError      bool
+	HandlerContainer []*HandlerContainer
+	StructContainer  []*StructContainer
+
+	// Services are mounted on the Router by their apigen:service annotations
+	Services []*ServiceContainer
+
+	// Metrics instruments the endpoints, see -metrics
+	Metrics bool
+
+	fset        *token.FileSet
+	pkg         *types.Package
+	info        *types.Info
+	structs     map[*types.TypeName]*StructContainer
+	diagnostics []diagnostic
+
+	// Methods are the declared methods as Type.Method
+	Methods map[string]bool
+
+	// Patterns are the regexps compiled into apigenPattern<index> vars
+	Patterns []string
+	Formats  map[string]bool
+
+	imports map[string]bool
+}
+
+// pattern returns the var holding the compiled expr
+func (c *Collector) pattern(expr string) string {
+	c.use("regexp")
+	for i, p := range c.Patterns {
+		if p == expr {
+			return fmt.Sprintf("apigenPattern%d", i)
+		}
+	}
+	c.Patterns = append(c.Patterns, expr)
+	return fmt.Sprintf("apigenPattern%d", len(c.Patterns)-1)
+}
+
+// format returns the helper checking the email or url format
+func (c *Collector) format(name string) string {
+	if c.Formats == nil {
+		c.Formats = make(map[string]bool)
+	}
+	c.Formats[name] = true
+	if name == "email" {
+		c.use("net/mail")
+		return "apigenIsEmail"
+	}
+	return "apigenIsURL"
+}
+
+// use records packages the generated code refers to
+func (c *Collector) use(paths ...string) {
+	if c.imports == nil {
+		c.imports = make(map[string]bool)
+	}
+	for _, path := range paths {
+		if path != "" {
+			c.imports[path] = true
+		}
+	}
+}
+
+// receivers returns the sorted names of the types having api methods
+func (c *Collector) receivers() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, handler := range c.HandlerContainer {
+		if !seen[handler.Receiver] {
+			seen[handler.Receiver] = true
+			names = append(names, handler.Receiver)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Collector) importList() []string {
+	return sortedKeys(c.imports)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func visitor(node ast.Node) bool {
+	funcDecl, ok := node.(*ast.FuncDecl)
+	if ok {
+		if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+			recv := funcDecl.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			collector := GetCollector()
+			if collector.Methods == nil {
+				collector.Methods = make(map[string]bool)
+			}
+			collector.Methods[types.ExprString(recv)+"."+funcDecl.Name.Name] = true
+		}
+
+		text, pos, ok := annotation(funcDecl.Doc, "apigen:api")
+		if ok {
+			if obj := GetCollector().parseHandler(funcDecl, text, pos); obj != nil {
+				collector := GetCollector()
+				collector.HandlerContainer = append(collector.HandlerContainer, obj)
+			}
+		}
+	}
+
+	if genDecl, ok := node.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			doc := typeSpec.Doc
+			if doc == nil && !genDecl.Lparen.IsValid() {
+				doc = genDecl.Doc
+			}
+			text, pos, ok := annotation(doc, "apigen:service")
+			if !ok {
+				continue
+			}
+			if obj := GetCollector().parseService(typeSpec, text, pos); obj != nil {
+				collector := GetCollector()
+				collector.Services = append(collector.Services, obj)
+			}
+		}
+	}
+
+	currType, okSpec := node.(*ast.TypeSpec)
+	if okSpec {
+		if currType.Name.Name == "ApiError" {
+			GetCollector().HasApiError = true
+		}
+	}
+
+	return true
+}
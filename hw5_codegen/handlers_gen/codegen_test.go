@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// the generator exits on errors and keeps its state in the collector,
+// so the tests run it in a child process of the test binary
+func TestMain(m *testing.M) {
+	if os.Getenv("APIGEN_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// newModule copies the files of testdata/name into a module of its own,
+// the sources are given as name: content pairs for the name ""
+func newModule(t *testing.T, name string, sources ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"go.mod": "module apigentest\n\ngo 1.26\n",
+	}
+	if name != "" {
+		root := filepath.Join("testdata", name)
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			files[rel] = string(data)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i+1 < len(sources); i += 2 {
+		files[sources[i]] = sources[i+1]
+	}
+
+	for file, data := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// generate runs the generator in dir, returning its output
+func generate(t *testing.T, dir string, args ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "APIGEN_TEST_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// goTest runs go vet and go test on the module in dir
+func goTest(t *testing.T, dir string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+
+	for _, args := range [][]string{{"vet", "."}, {"test", "."}} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+}
+
+func TestNestedParams(t *testing.T) {
+	dir := newModule(t, "nested")
+	if out, err := generate(t, dir, "-tests", "api_handlers_test.go", "api.go", "api_handlers.go"); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	src, err := ioutil.ReadFile(filepath.Join(dir, "api_handlers.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, param := range []string{`"address.city"`, `"address.zip"`, `"work.city"`, `"limit"`, `"offset"`, `"first"`, `"last"`} {
+		if !strings.Contains(string(src), param) {
+			t.Errorf("no %s param in the generated code", param)
+		}
+	}
+
+	goTest(t, dir)
+}
+
+func TestStreams(t *testing.T) {
+	dir := newModule(t, "streams")
+	if out, err := generate(t, dir, "-client", "api_client.go", "-tests", "api_handlers_test.go", "api.go", "api_handlers.go"); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	goTest(t, dir)
+}
+
+func TestOpenAPI(t *testing.T) {
+	dir := newModule(t, "openapi")
+	for _, spec := range []string{"spec.json", "spec.yaml"} {
+		if out, err := generate(t, dir, "-openapi", spec, "api.go", "api_handlers.go"); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+
+		got, err := ioutil.ReadFile(filepath.Join(dir, spec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden := filepath.Join("testdata", "openapi", "golden", spec)
+		if *update {
+			if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s differs from %s, run go test -update if it is right:\n%s", spec, golden, got)
+		}
+	}
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name     string
+				In       string
+				Required bool
+			}
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]struct {
+							Enum    []interface{}
+							Default interface{}
+						}
+						Required []string
+					}
+				}
+			}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage
+			}
+		}
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "spec.json"))
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	params := doc.Paths["/users/{id}"]["get"].Parameters
+	if len(params) == 0 || params[0].Name != "id" || params[0].In != "path" || !params[0].Required {
+		t.Errorf("path param: got %+v", params)
+	}
+	form := doc.Paths["/users"]["post"].RequestBody.Content["application/x-www-form-urlencoded"].Schema
+	if status := form.Properties["status"]; fmt.Sprint(status.Enum) != "[active banned]" || status.Default != "active" {
+		t.Errorf("status: got %+v", status)
+	}
+	if limit := form.Properties["limit"]; limit.Default != 10.0 {
+		t.Errorf("limit: got %+v", limit)
+	}
+	if fmt.Sprint(form.Required) != "[email]" {
+		t.Errorf("required: got %v", form.Required)
+	}
+	for _, name := range []string{"User", "models.Address"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("no %s schema", name)
+		}
+	}
+	user := doc.Components.Schemas["User"].Properties
+	for _, property := range []string{"status", "home", "created_by"} {
+		if _, ok := user[property]; !ok {
+			t.Errorf("no %s property of User", property)
+		}
+	}
+	if _, ok := user["secret"]; ok {
+		t.Errorf("unexported secret is described")
+	}
+}
+
+func TestOpenAPIUnsupported(t *testing.T) {
+	src := fmt.Sprintf(diagnosticsSource, "Nick string\n\tNotify func()", `{"url": "/do"}`, "")
+	dir := newModule(t, "", "api.go", src)
+	out, err := generate(t, dir, "-openapi", "spec.json", "api.go", "api_handlers.go")
+	if want := "api.go:13:17: Api.Do result: Params: Notify: can't describe func() in JSON"; err == nil || !strings.Contains(out, want) {
+		t.Errorf("got %v %s, want %s", err, out, want)
+	}
+}
+
+func TestUncheckedField(t *testing.T) {
+	src := fmt.Sprintf(diagnosticsSource, "Nick string `apivalidator:\"paramname=nick\"`\n\tAge  int    `apivalidator:\"min=1\"`", `{"url": "/do"}`, "")
+	dir := newModule(t, "", "api.go", src)
+	if out, err := generate(t, dir, "api.go", "api_handlers.go"); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	gen, err := ioutil.ReadFile(filepath.Join(dir, "api_handlers.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(gen), `errs.has("Nick")`) {
+		t.Errorf("checks are rendered for Nick having no rules")
+	}
+	if !strings.Contains(string(gen), `errs.has("Age")`) {
+		t.Errorf("no checks are rendered for Age")
+	}
+}
+
+// TestGeneratedFiles checks that the files go:generate writes
+// next to the generator are up to date
+func TestGeneratedFiles(t *testing.T) {
+	src, err := ioutil.ReadFile("../main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const directive = "//go:generate go run ./handlers_gen "
+	for _, line := range strings.Split(string(src), "\n") {
+		if !strings.HasPrefix(line, directive) {
+			continue
+		}
+		args := append([]string{"-check"}, strings.Fields(strings.TrimPrefix(line, directive))...)
+		if out, err := generate(t, "..", args...); err != nil {
+			t.Errorf("%v\n%s", err, out)
+		}
+		return
+	}
+	t.Fatal("no go:generate line in main.go")
+}
+
+// diagnosticsSource is an api with the given params fields, apigen:api
+// options of Do and more declarations starting at line 20, Base can be
+// embedded in the params
+const diagnosticsSource = `package api
+
+import "context"
+
+type Api struct{}
+
+type Params struct {
+	%s
+}
+
+// apigen:api %s
+func (srv *Api) Do(ctx context.Context, in Params) (*Params, error) {
+	return &in, nil
+}
+
+type Base struct {
+	ID int ` + "`apivalidator:\"min=1\"`" + `
+}
+
+%s
+`
+
+func TestDiagnostics(t *testing.T) {
+	cases := []struct {
+		name    string
+		fields  string
+		options string
+		decls   string
+		want    string
+	}{
+		{
+			name:    "rule after pattern",
+			fields:  "Nick string `apivalidator:\"pattern=^[a-z]+$,required\"`",
+			options: `{"url": "/do"}`,
+			want:    "api.go:8:2: Params.Nick: pattern must be the last rule, required follows it",
+		},
+		{
+			name:    "embedded struct",
+			fields:  "Base\n\terror",
+			options: `{"url": "/do"}`,
+		},
+		{
+			name:    "embedded pointer",
+			fields:  "*Base",
+			options: `{"url": "/do"}`,
+			want:    "api.go:8:3: Params.Base: the embedded pointer *Base can't be filled, embed Base",
+		},
+		{
+			name:    "embedded struct with rules",
+			fields:  "Base `apivalidator:\"required\"`",
+			options: `{"url": "/do"}`,
+			want:    "api.go:8:2: Params.Base: only paramname is supported for the nested struct Base",
+		},
+		{
+			name:    "rate by auth without auth",
+			fields:  "Nick string",
+			options: `{"url": "/do", "rate": "10/s", "rate_key": "auth"}`,
+			want:    `rate_key auth needs "auth": true`,
+		},
+		{
+			name:    "rate by auth",
+			fields:  "Nick string",
+			options: `{"url": "/do", "auth": true, "rate": "10/s", "rate_key": "auth"}`,
+		},
+		{
+			name:    "pattern with commas",
+			fields:  "Nick string `apivalidator:\"required,pattern=^[a-z]{1,8}$\"`",
+			options: `{"url": "/do"}`,
+		},
+		{
+			name:    "unknown rule",
+			fields:  "Nick string `apivalidator:\"requird\"`",
+			options: `{"url": "/do"}`,
+			want:    "api.go:8:2: Params.Nick: unknown apivalidator rule \"requird\"",
+		},
+		{
+			name:    "unsupported field type",
+			fields:  "Tags map[string]string `apivalidator:\"\"`",
+			options: `{"url": "/do"}`,
+			want:    "api.go:8:2: Params.Tags: unsupported type map[string]string",
+		},
+		{
+			name:    "bad annotation",
+			fields:  "Nick string",
+			options: `{"url": "/do"`,
+			want:    "api.go:11:1: bad apigen:api annotation: unexpected EOF",
+		},
+		{
+			name:    "not an annotation",
+			fields:  "Nick string",
+			options: `{"url": "/do"}`,
+			decls:   "// Other is no apigen:api {\"url\": method\nfunc (srv *Api) Other() {}",
+		},
+		{
+			name:    "wrong signature",
+			fields:  "Nick string",
+			options: `{"url": "/do"}`,
+			decls:   "// apigen:api {\"url\": \"/other\"}\nfunc (srv *Api) Other(in Params) error { return nil }",
+			want:    "api.go:21:1: Other must have the signature (ctx context.Context, in T) (R, error)",
+		},
+		{
+			name:    "duplicate url",
+			fields:  "Nick string",
+			options: `{"url": "/do"}`,
+			decls:   "// apigen:api {\"url\": \"/do\"}\nfunc (srv *Api) Again(ctx context.Context, in Params) (*Params, error) { return &in, nil }",
+			want:    "api.go:21:17: /do is already served by Api.Do as /do",
+		},
+		{
+			name:    "duplicate url placeholders",
+			fields:  "ID string `apivalidator:\"path,paramname=id\"`",
+			options: `{"url": "/user/{id}"}`,
+			decls: "type Named struct {\n\tName string `apivalidator:\"path,paramname=name\"`\n}\n\n" +
+				"// apigen:api {\"url\": \"/user/{name}\"}\nfunc (srv *Api) ByName(ctx context.Context, in Named) (*Named, error) { return &in, nil }",
+			want: "api.go:25:17: /user/{name} is already served by Api.Do as /user/{id}",
+		},
+	}
+
+	for _, item := range cases {
+		t.Run(item.name, func(t *testing.T) {
+			dir := newModule(t, "", "api.go", fmt.Sprintf(diagnosticsSource, item.fields, item.options, item.decls))
+			out, err := generate(t, dir, "api.go", "api_handlers.go")
+			switch {
+			case item.want == "" && err != nil:
+				t.Errorf("unexpected error %v\n%s", err, out)
+			case item.want != "" && err == nil:
+				t.Errorf("no error, want %s", item.want)
+			case !strings.Contains(out, item.want):
+				t.Errorf("got %s, want %s", out, item.want)
+			}
+		})
+	}
+}
+
+// serviceSource mounts two apis on the Router
+const serviceSource = `package api
+
+import "context"
+
+type Params struct {
+	ID string ` + "`apivalidator:\"path\"`" + `
+}
+
+// apigen:service {"prefix": "/v1"}
+type Users struct{}
+
+// apigen:api {"url": "%s"}
+func (srv *Users) Get(ctx context.Context, in Params) (*Params, error) {
+	return &in, nil
+}
+
+// apigen:service {"prefix": "%s"}
+type Groups struct{}
+
+// apigen:api {"url": "%s"}
+func (srv *Groups) Get(ctx context.Context, in Params) (*Params, error) {
+	return &in, nil
+}
+`
+
+func TestRouterCollisions(t *testing.T) {
+	cases := []struct {
+		name string
+		urls [3]string
+		want string
+	}{
+		{
+			name: "same path",
+			urls: [3]string{"/user/{id}", "/v1/user", "/{id}"},
+			want: "api.go:21:20: /v1/user/{id} collides on the Router with /v1/user/{id} of Users.Get",
+		},
+		{
+			name: "placeholders",
+			urls: [3]string{"/user/{id}", "/v1/user", "/{name}"},
+			want: "collides on the Router with /v1/user/{id} of Users.Get",
+		},
+		{
+			name: "other prefix",
+			urls: [3]string{"/user/{id}", "/v2/user", "/{id}"},
+		},
+	}
+
+	for _, item := range cases {
+		t.Run(item.name, func(t *testing.T) {
+			dir := newModule(t, "", "api.go", fmt.Sprintf(serviceSource, item.urls[0], item.urls[1], item.urls[2]))
+			out, err := generate(t, dir, "api.go", "api_handlers.go")
+			switch {
+			case item.want == "" && err != nil:
+				t.Errorf("unexpected error %v\n%s", err, out)
+			case item.want != "" && err == nil:
+				t.Errorf("no error, want %s", item.want)
+			case !strings.Contains(out, item.want):
+				t.Errorf("got %s, want %s", out, item.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// diagnostic is a problem found in the sources, printed like go vet
+// reports them as file:line:col: message
+type diagnostic struct {
+	pos token.Position
+	msg string
+}
+
+func (d diagnostic) Error() string {
+	return d.pos.String() + ": " + d.msg
+}
+
+// errorAt returns a diagnostic for the given position
+func (c *Collector) errorAt(pos token.Pos, format string, args ...interface{}) error {
+	d := diagnostic{msg: fmt.Sprintf(format, args...)}
+	if c.fset != nil {
+		d.pos = c.fset.Position(pos)
+	}
+	return d
+}
+
+// errorf records a diagnostic, the sources are checked completely
+// before they are reported
+func (c *Collector) errorf(pos token.Pos, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, c.errorAt(pos, format, args...).(diagnostic))
+}
+
+// reportDiagnostics prints the recorded diagnostics ordered by position
+// and exits with status 1 if there are any
+func (c *Collector) reportDiagnostics() {
+	if len(c.diagnostics) == 0 {
+		return
+	}
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i].pos, c.diagnostics[j].pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	for _, d := range c.diagnostics {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	os.Exit(1)
+}
+
+// checkHandlers reports the urls served by several methods of a receiver
+// and the ones taken by the generated endpoints
+func (c *Collector) checkHandlers() {
+	if obj := c.pkg.Scope().Lookup("MetricsHandler"); c.Metrics && obj != nil {
+		c.errorf(obj.Pos(), "MetricsHandler is generated for -metrics, rename this one")
+	}
+
+	seen := make(map[string]*HandlerContainer)
+	for _, handler := range c.HandlerContainer {
+		if c.Metrics && handler.Url == metricsPath {
+			c.errorf(handler.Pos, "%s is served by the metrics of -metrics", metricsPath)
+			continue
+		}
+
+		// placeholders match any segment, whatever their names
+		key := handler.Receiver + " " + strings.Join(handler.Segments(), "/")
+		if first, ok := seen[key]; ok {
+			c.errorf(handler.Pos, "%s is already served by %s.%s as %s", handler.Url, first.Receiver, first.StructMethod, first.Url)
+			continue
+		}
+		seen[key] = handler
+	}
+}
+
+// annotation finds the comment of a doc starting with the marker, like
+// apigen:api, and returns the text following it, which starts with the
+// JSON object
+func annotation(doc *ast.CommentGroup, marker string) (string, token.Pos, bool) {
+	if doc == nil {
+		return "", token.NoPos, false
+	}
+
+	for i, comment := range doc.List {
+		text := strings.TrimPrefix(comment.Text, "//")
+		if strings.HasPrefix(text, "/*") {
+			text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		}
+		text = strings.TrimSpace(text)
+		if !strings.HasPrefix(text, marker) {
+			continue
+		}
+
+		rest := []string{strings.TrimPrefix(text, marker)}
+		for _, next := range doc.List[i+1:] {
+			rest = append(rest, strings.TrimPrefix(next.Text, "//"))
+		}
+		return strings.Join(rest, "\n"), comment.Pos(), true
+	}
+
+	return "", token.NoPos, false
+}
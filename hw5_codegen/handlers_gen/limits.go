@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseLimits checks the timeout and rate limit fields of the annotation,
+// a rate is given as requests per period like 10/s or 100/1m
+func (h *HandlerContainer) parseLimits() error {
+	if h.Timeout != "" {
+		timeout, err := time.ParseDuration(h.Timeout)
+		if err != nil || timeout <= 0 {
+			return errors.Errorf("bad timeout %q", h.Timeout)
+		}
+		h.TimeoutValue = timeout
+	}
+
+	if h.Rate == "" {
+		if h.Burst != 0 || h.RateKey != "" {
+			return errors.New("burst and rate_key need a rate")
+		}
+		return nil
+	}
+
+	parts := strings.SplitN(h.Rate, "/", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("bad rate %q, want requests/period", h.Rate)
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count <= 0 {
+		return errors.Errorf("bad rate %q, want requests/period", h.Rate)
+	}
+	period := parts[1]
+	if period != "" && strings.IndexAny(period[:1], "0123456789") < 0 {
+		period = "1" + period
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return errors.Errorf("bad rate period %q", parts[1])
+	}
+	h.RatePerSecond = float64(count) / duration.Seconds()
+
+	if h.Burst < 0 {
+		return errors.Errorf("bad burst %d", h.Burst)
+	}
+	if h.Burst == 0 {
+		h.Burst = count
+	}
+
+	switch h.RateKey {
+	case "":
+		h.RateKey = "ip"
+	case "ip":
+	case "auth":
+		// only the identity of an authorized request can be trusted
+		if !h.Auth {
+			return errors.New(`rate_key auth needs "auth": true`)
+		}
+	default:
+		return errors.Errorf("unknown rate_key %q, want ip or auth", h.RateKey)
+	}
+
+	return nil
+}
+
+// TimeoutLiteral renders the timeout as a Go expression
+func (h *HandlerContainer) TimeoutLiteral() string {
+	for _, unit := range []struct {
+		duration time.Duration
+		name     string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+	} {
+		if h.TimeoutValue%unit.duration == 0 {
+			return fmt.Sprintf("%d * %s", h.TimeoutValue/unit.duration, unit.name)
+		}
+	}
+	return fmt.Sprintf("time.Duration(%d)", int64(h.TimeoutValue))
+}
+
+// RateLiteral renders the number of requests allowed per second
+func (h *HandlerContainer) RateLiteral() string {
+	return strconv.FormatFloat(h.RatePerSecond, 'g', -1, 64)
+}
+
+// HasRateLimits reports whether some endpoint is rate limited
+func (c *Collector) HasRateLimits() bool {
+	for _, handler := range c.HandlerContainer {
+		if handler.Rate != "" {
+			return true
+		}
+	}
+	return false
+}
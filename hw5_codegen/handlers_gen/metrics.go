@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+)
+
+// metricsPath is served by every api when -metrics is set
+const metricsPath = "/metrics"
+
+// metricsLabelEscaper escapes label values as the Prometheus text format wants
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// MetricLabels renders the labels of the endpoint metrics, they come from
+// the annotation so that paths with placeholders make a single series
+func (h *HandlerContainer) MetricLabels() string {
+	method := h.Method
+	if method == "" {
+		method = "ANY"
+	}
+
+	var labels []string
+	for _, label := range [][2]string{
+		{"receiver", h.Receiver},
+		{"url", h.Url},
+		{"method", method},
+	} {
+		labels = append(labels, label[0]+`="`+metricsLabelEscaper.Replace(label[1])+`"`)
+	}
+	return strings.Join(labels, ",")
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go/token"
+	"go/types"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type openAPIDoc struct {
+	OpenAPI    string                      `json:"openapi"`
+	Info       openAPIInfo                 `json:"info"`
+	Servers    []openAPIServer             `json:"servers,omitempty"`
+	Paths      map[string]*openAPIPathItem `json:"paths"`
+	Components openAPIComponents           `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIPathItem struct {
+	Get  *openAPIOperation `json:"get,omitempty"`
+	Post *openAPIOperation `json:"post,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Tags        []string                    `json:"tags"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Headers     map[string]*openAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Description string         `json:"description,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `json:"$ref,omitempty"`
+	Type       string                    `json:"type,omitempty"`
+	Format     string                    `json:"format,omitempty"`
+	Nullable   bool                      `json:"nullable,omitempty"`
+	Items      *openAPISchema            `json:"items,omitempty"`
+	Properties map[string]*openAPISchema `json:"properties,omitempty"`
+
+	AdditionalProperties *openAPISchema `json:"additionalProperties,omitempty"`
+
+	Required  []string      `json:"required,omitempty"`
+	Enum      []interface{} `json:"enum,omitempty"`
+	Default   interface{}   `json:"default,omitempty"`
+	Minimum   *float64      `json:"minimum,omitempty"`
+	Maximum   *float64      `json:"maximum,omitempty"`
+	MinLength *int          `json:"minLength,omitempty"`
+	MaxLength *int          `json:"maxLength,omitempty"`
+	MinItems  *int          `json:"minItems,omitempty"`
+	MaxItems  *int          `json:"maxItems,omitempty"`
+	Pattern   string        `json:"pattern,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*openAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type openAPISecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+const openAPISecurityName = "apiKey"
+
+// RenderOpenAPI describes the handlers of the receiver in OpenAPI 3,
+// as YAML for .yaml and .yml paths and as JSON otherwise
+func RenderOpenAPI(receiver string, path string) ([]byte, error) {
+	container := GetCollector()
+
+	doc := &openAPIDoc{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:   receiver,
+			Version: "1.0.0",
+		},
+		Paths: make(map[string]*openAPIPathItem),
+		Components: openAPIComponents{
+			Schemas: map[string]*openAPISchema{
+				"Error": {
+					Type:       "object",
+					Properties: map[string]*openAPISchema{"error": {Type: "string"}},
+					Required:   []string{"error"},
+				},
+			},
+		},
+	}
+
+	// the paths are relative to the prefix the Router mounts the api on
+	if service := container.service(receiver); service != nil && service.Prefix != "" {
+		doc.Servers = []openAPIServer{{URL: service.Prefix}}
+	}
+
+	for _, handler := range container.HandlerContainer {
+		if handler.Receiver != receiver {
+			continue
+		}
+
+		structContainer := handler.Struct
+
+		item, ok := doc.Paths[handler.Url]
+		if !ok {
+			item = &openAPIPathItem{}
+			doc.Paths[handler.Url] = item
+		}
+
+		var err error
+		if handler.Method == "" || handler.Method == http.MethodGet {
+			if item.Get, err = doc.operation(handler, structContainer, http.MethodGet); err != nil {
+				return nil, container.errorAt(handler.Pos, "%s.%s result: %v", handler.Receiver, handler.StructMethod, err)
+			}
+		}
+		if handler.Method == "" || handler.Method == http.MethodPost {
+			if item.Post, err = doc.operation(handler, structContainer, http.MethodPost); err != nil {
+				return nil, container.errorAt(handler.Pos, "%s.%s result: %v", handler.Receiver, handler.StructMethod, err)
+			}
+			if item.Get != nil {
+				// operation ids are unique across the document
+				item.Post.OperationID += "Post"
+			}
+		}
+		if handler.Auth {
+			doc.Components.SecuritySchemes = map[string]*openAPISecurityScheme{
+				openAPISecurityName: {Type: "apiKey", In: "header", Name: "X-Auth"},
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return jsonToYAML(data)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// fieldErrors registers the schema of the violations listed by
+// the endpoints annotated with "errors": "all"
+func (doc *openAPIDoc) fieldErrors() *openAPISchema {
+	doc.Components.Schemas["FieldErrors"] = &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"error": {Type: "string"},
+			"fields": {
+				Type: "array",
+				Items: &openAPISchema{
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"param":   {Type: "string"},
+						"rule":    {Type: "string"},
+						"message": {Type: "string"},
+					},
+					Required: []string{"param", "rule", "message"},
+				},
+			},
+		},
+		Required: []string{"error", "fields"},
+	}
+	return &openAPISchema{Ref: "#/components/schemas/FieldErrors"}
+}
+
+func (doc *openAPIDoc) operation(handler *HandlerContainer, params *StructContainer, method string) (*openAPIOperation, error) {
+	content, err := doc.resultContent(handler)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &openAPIOperation{
+		OperationID: handler.StructMethod,
+		Tags:        []string{handler.Receiver},
+		Responses: map[string]*openAPIResponse{
+			"200": {
+				Description: "OK",
+				Content:     content,
+			},
+			"400": errorResponse("invalid params"),
+			"404": errorResponse("unknown method"),
+			"500": errorResponse("internal error"),
+		},
+	}
+
+	if handler.Errors == "all" {
+		op.Responses["400"] = &openAPIResponse{
+			Description: "invalid params",
+			Content:     jsonContent(doc.fieldErrors()),
+		}
+	}
+	if handler.Method != "" {
+		op.Responses["406"] = errorResponse("bad method")
+	}
+	if handler.Rate != "" {
+		response := errorResponse("too many requests")
+		response.Headers = map[string]*openAPIHeader{
+			"Retry-After": {
+				Description: "seconds to wait before retrying",
+				Schema:      &openAPISchema{Type: "integer"},
+			},
+		}
+		op.Responses["429"] = response
+	}
+	if handler.Timeout != "" {
+		op.Responses["504"] = errorResponse("timeout")
+	}
+	if handler.Auth {
+		op.Responses["403"] = errorResponse("unauthorized")
+		op.Security = []map[string][]string{{openAPISecurityName: {}}}
+	}
+
+	for _, field := range params.Fields {
+		if field.Path || method == http.MethodGet {
+			parameter := &openAPIParameter{
+				Name:     field.ParamName,
+				In:       "query",
+				Required: field.Required,
+				Schema:   fieldSchema(field),
+			}
+			if field.Path {
+				parameter.In = "path"
+				parameter.Required = true
+			}
+			op.Parameters = append(op.Parameters, parameter)
+		}
+	}
+	if method == http.MethodGet {
+		return op, nil
+	}
+
+	form := &openAPISchema{
+		Type:       "object",
+		Properties: make(map[string]*openAPISchema),
+	}
+	for _, field := range params.Fields {
+		if field.Path {
+			continue
+		}
+		form.Properties[field.ParamName] = fieldSchema(field)
+		if field.Required {
+			form.Required = append(form.Required, field.ParamName)
+		}
+	}
+	op.RequestBody = &openAPIRequestBody{
+		Required: len(form.Required) > 0,
+		Content: map[string]*openAPIMediaType{
+			"application/x-www-form-urlencoded": {Schema: form},
+			"application/json":                  {Schema: form},
+		},
+	}
+	if params.HasFiles() {
+		op.RequestBody.Content = map[string]*openAPIMediaType{
+			"multipart/form-data": {Schema: form},
+		}
+	}
+	op.Responses["413"] = errorResponse("request body too large")
+	op.Responses["415"] = errorResponse("unsupported content type")
+
+	return op, nil
+}
+
+// resultContent describes the response of a successful call, the JSON
+// envelope or the raw bytes and items of streamed results
+func (doc *openAPIDoc) resultContent(handler *HandlerContainer) (map[string]*openAPIMediaType, error) {
+	switch handler.Response {
+	case "raw":
+		return map[string]*openAPIMediaType{
+			handler.ContentType: {Schema: &openAPISchema{Type: "string", Format: "binary"}},
+		}, nil
+	case "ndjson":
+		items, err := doc.typeSchema(handler.ResultType.Underlying().(*types.Chan).Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]*openAPIMediaType{
+			"application/x-ndjson": {Schema: items},
+		}, nil
+	case "sse":
+		return map[string]*openAPIMediaType{
+			"text/event-stream": {Schema: &openAPISchema{Type: "string"}},
+		}, nil
+	}
+
+	result, err := doc.typeSchema(handler.ResultType)
+	if err != nil {
+		return nil, err
+	}
+	return jsonContent(doc.envelope(result)), nil
+}
+
+// envelope wraps the schema of the method result into {"error", "response"}
+func (doc *openAPIDoc) envelope(result *openAPISchema) *openAPISchema {
+	return &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"error":    {Type: "string"},
+			"response": result,
+		},
+		Required: []string{"error"},
+	}
+}
+
+// typeSchema describes a Go type as encoding/json writes it, registering
+// the schemas of the named structs it refers to in the components
+func (doc *openAPIDoc) typeSchema(t types.Type) (*openAPISchema, error) {
+	t = types.Unalias(t)
+
+	if named, ok := t.(*types.Named); ok {
+		name := types.TypeString(named, GetCollector().qualify)
+		if name == "time.Time" {
+			return basicSchema(name), nil
+		}
+		if types.Implements(named, jsonMarshaler) || types.Implements(types.NewPointer(named), jsonMarshaler) {
+			return nil, errors.Errorf("%s implements json.Marshaler", name)
+		}
+
+		structType, ok := named.Underlying().(*types.Struct)
+		if !ok {
+			// named basic types, slices and maps are written like their underlying type
+			return doc.typeSchema(named.Underlying())
+		}
+
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			schema := &openAPISchema{
+				Type:       "object",
+				Properties: make(map[string]*openAPISchema),
+			}
+			// registered before the fields to stop on recursive types
+			doc.Components.Schemas[name] = schema
+			if err := doc.addProperties(schema, structType); err != nil {
+				return nil, errors.Wrap(err, name)
+			}
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + name}, nil
+	}
+
+	switch t := t.(type) {
+	case *types.Basic:
+		if schema := basicSchema(t.Name()); schema != nil {
+			return schema, nil
+		}
+	case *types.Pointer:
+		schema, err := doc.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema, nil
+	case *types.Slice:
+		if basic, ok := types.Unalias(t.Elem()).(*types.Basic); ok && basic.Kind() == types.Byte {
+			// encoding/json writes byte slices as base64
+			return &openAPISchema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := doc.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &openAPISchema{Type: "array", Items: items}, nil
+	case *types.Array:
+		items, err := doc.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		length := int(t.Len())
+		return &openAPISchema{Type: "array", Items: items, MinItems: &length, MaxItems: &length}, nil
+	case *types.Map:
+		if key, ok := t.Key().Underlying().(*types.Basic); ok && key.Info()&(types.IsString|types.IsInteger) != 0 {
+			values, err := doc.typeSchema(t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			return &openAPISchema{Type: "object", AdditionalProperties: values}, nil
+		}
+	case *types.Struct:
+		schema := &openAPISchema{
+			Type:       "object",
+			Properties: make(map[string]*openAPISchema),
+		}
+		return schema, doc.addProperties(schema, t)
+	case *types.Interface:
+		if t.Empty() {
+			return &openAPISchema{}, nil
+		}
+	}
+
+	return nil, errors.Errorf("can't describe %s in JSON", types.TypeString(t, GetCollector().qualify))
+}
+
+// jsonMarshaler is the interface of the types writing JSON of their own
+var jsonMarshaler = types.NewInterfaceType([]*types.Func{
+	types.NewFunc(token.NoPos, nil, "MarshalJSON", types.NewSignatureType(nil, nil, nil, nil,
+		types.NewTuple(
+			types.NewParam(token.NoPos, nil, "", types.NewSlice(types.Typ[types.Byte])),
+			types.NewParam(token.NoPos, nil, "", types.Universe.Lookup("error").Type()),
+		), false)),
+}, nil).Complete()
+
+// addProperties follows encoding/json naming: json tags, "-" and
+// fields of embedded structs
+func (doc *openAPIDoc) addProperties(schema *openAPISchema, structType *types.Struct) error {
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+
+		tag := reflect.StructTag(structType.Tag(i)).Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Embedded() && name == "" {
+			embedded := types.Unalias(field.Type())
+			if ptr, ok := embedded.(*types.Pointer); ok {
+				embedded = types.Unalias(ptr.Elem())
+			}
+			if st, ok := embedded.Underlying().(*types.Struct); ok {
+				if err := doc.addProperties(schema, st); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.Exported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name()
+		}
+		property, err := doc.typeSchema(field.Type())
+		if err != nil {
+			return errors.Wrap(err, field.Name())
+		}
+		schema.Properties[name] = property
+	}
+	return nil
+}
+
+func basicSchema(goType string) *openAPISchema {
+	switch goType {
+	case "string":
+		return &openAPISchema{Type: "string"}
+	case "bool":
+		return &openAPISchema{Type: "boolean"}
+	case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "byte", "rune":
+		return &openAPISchema{Type: "integer"}
+	case "int64", "uint64":
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case "float32":
+		return &openAPISchema{Type: "number", Format: "float"}
+	case "float64":
+		return &openAPISchema{Type: "number", Format: "double"}
+	case "time.Time":
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case "interface{}", "any":
+		return &openAPISchema{}
+	}
+	return nil
+}
+
+// fieldSchema describes a validated param with its apivalidator rules,
+// for slices enum describes the items and min, max their number
+func fieldSchema(field *StructField) *openAPISchema {
+	if field.File != "" {
+		return &openAPISchema{Type: "string", Format: "binary"}
+	}
+
+	schema := basicSchema(field.BaseType)
+	if schema == nil {
+		return &openAPISchema{}
+	}
+
+	for _, value := range field.Enum {
+		schema.Enum = append(schema.Enum, schemaValue(field, value))
+	}
+	if field.HasDefault {
+		schema.Default = schemaValue(field, field.Default)
+	}
+	schema.Pattern = field.Pattern
+	switch field.Format {
+	case "email", "uuid":
+		schema.Format = field.Format
+	case "url":
+		schema.Format = "uri"
+	}
+	if field.Slice {
+		schema = &openAPISchema{Type: "array", Items: schema}
+	}
+
+	for _, bound := range []struct {
+		value  string
+		number **float64
+		length **int
+		items  **int
+	}{
+		{field.Min, &schema.Minimum, &schema.MinLength, &schema.MinItems},
+		{field.Max, &schema.Maximum, &schema.MaxLength, &schema.MaxItems},
+		{field.Len, &schema.Minimum, &schema.MinLength, &schema.MinItems},
+		{field.Len, &schema.Maximum, &schema.MaxLength, &schema.MaxItems},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		number, _ := strconv.ParseFloat(bound.value, 64)
+		length := int(number)
+
+		switch schema.Type {
+		case "string":
+			*bound.length = &length
+		case "array":
+			*bound.items = &length
+		default:
+			*bound.number = &number
+		}
+	}
+
+	return schema
+}
+
+// schemaValue converts a tag value checked by checkLiteral into the JSON value
+func schemaValue(field *StructField, value string) interface{} {
+	switch field.BaseType {
+	case "string":
+		return value
+	case "bool":
+		v, _ := strconv.ParseBool(value)
+		return v
+	}
+	v, _ := strconv.ParseFloat(value, 64)
+	return v
+}
+
+func jsonContent(schema *openAPISchema) map[string]*openAPIMediaType {
+	return map[string]*openAPIMediaType{
+		"application/json": {Schema: schema},
+	}
+}
+
+func errorResponse(description string) *openAPIResponse {
+	return &openAPIResponse{
+		Description: description,
+		Content:     jsonContent(&openAPISchema{Ref: "#/components/schemas/Error"}),
+	}
+}
+
+// jsonToYAML re-encodes a JSON document as block style YAML keeping the key order
+func jsonToYAML(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	out := &bytes.Buffer{}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeYAML(out, dec, tok, 0, true); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// writeYAML writes the value starting with tok. Values follow their key or
+// dash on the same line, inline is set when nothing but the dash was written
+// there, so a mapping can start right after it
+func writeYAML(out io.Writer, dec *json.Decoder, tok json.Token, indent int, inline bool) error {
+	pad := strings.Repeat("  ", indent)
+	sep := " "
+	if inline {
+		sep = ""
+	}
+
+	switch tok {
+	case json.Delim('{'), json.Delim('['):
+		if !dec.More() {
+			empty := "{}"
+			if tok == json.Delim('[') {
+				empty = "[]"
+			}
+			fmt.Fprintln(out, sep+empty)
+			_, err := dec.Token()
+			return err
+		}
+
+		for first := true; dec.More(); first = false {
+			switch {
+			case first && inline:
+			case first && indent > 0:
+				fmt.Fprintln(out)
+				fmt.Fprint(out, pad)
+			default:
+				fmt.Fprint(out, pad)
+			}
+
+			if tok == json.Delim('[') {
+				fmt.Fprint(out, "- ")
+			} else {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "%s:", yamlString(key.(string)))
+			}
+
+			value, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := writeYAML(out, dec, value, indent+1, tok == json.Delim('[')); err != nil {
+				return err
+			}
+		}
+		_, err := dec.Token()
+		return err
+	}
+
+	switch v := tok.(type) {
+	case string:
+		fmt.Fprintln(out, sep+yamlString(v))
+	case json.Number:
+		fmt.Fprintln(out, sep+v.String())
+	case bool:
+		fmt.Fprintln(out, sep+strconv.FormatBool(v))
+	case nil:
+		fmt.Fprintln(out, sep+"null")
+	default:
+		return errors.Errorf("unexpected json token %v", tok)
+	}
+
+	return nil
+}
+
+// yamlString quotes strings that plain YAML scalars would misread
+func yamlString(s string) string {
+	if s == "" || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n") ||
+		strings.TrimSpace(s) != s || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?") {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ServiceContainer is a receiver mounted on the generated Router
+// by an apigen:service annotation on its type
+type ServiceContainer struct {
+	Receiver string
+	Prefix   string `json:"prefix"`
+	Pos      token.Pos
+}
+
+// Field names the service in the Router struct and the NewRouter params
+func (s *ServiceContainer) Field() string {
+	r, size := utf8.DecodeRuneInString(s.Receiver)
+	field := string(unicode.ToLower(r)) + s.Receiver[size:]
+	if token.IsKeyword(field) {
+		field += "Srv"
+	}
+	return field
+}
+
+// parseService reads the apigen:service annotation of a type
+func (c *Collector) parseService(typeSpec *ast.TypeSpec, text string, pos token.Pos) *ServiceContainer {
+	obj := &ServiceContainer{
+		Receiver: typeSpec.Name.Name,
+		Pos:      typeSpec.Name.Pos(),
+	}
+
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(obj); err != nil {
+		c.errorf(pos, "bad apigen:service annotation: %v", err)
+		return nil
+	}
+
+	if obj.Prefix != "" && !strings.HasPrefix(obj.Prefix, "/") {
+		c.errorf(pos, "prefix %q must start with /", obj.Prefix)
+		return nil
+	}
+	if strings.ContainsAny(obj.Prefix, "{}") {
+		c.errorf(pos, "prefix %q can't have placeholders", obj.Prefix)
+		return nil
+	}
+	obj.Prefix = strings.TrimRight(obj.Prefix, "/")
+
+	return obj
+}
+
+// service returns the apigen:service of the receiver, nil if it has none
+func (c *Collector) service(receiver string) *ServiceContainer {
+	for _, service := range c.Services {
+		if service.Receiver == receiver {
+			return service
+		}
+	}
+	return nil
+}
+
+// Route is a handler as a ServeHTTP dispatches to it: Srv is the
+// expression of the receiver, Path the url under its prefix and Var
+// the segments matched by apigenMatchPath
+type Route struct {
+	*HandlerContainer
+	Srv  string
+	Path string
+	Var  string
+}
+
+// Segments returns the path segments as apigenMatchPath expects them
+func (r *Route) Segments() []string {
+	return (&HandlerContainer{Url: r.Path}).Segments()
+}
+
+// Routes returns the routes of the receiver's own ServeHTTP
+func (rh *ReceiverHandlers) Routes() []*Route {
+	var routes []*Route
+	for _, handler := range rh.Handler {
+		routes = append(routes, &Route{
+			HandlerContainer: handler,
+			Srv:              "srv",
+			Path:             handler.Url,
+			Var:              "apigenRoute" + handler.Receiver + handler.StructMethod,
+		})
+	}
+	return routes
+}
+
+// routerRoutes returns the routes of the services under their prefixes,
+// ordered like the routes of a receiver
+func (c *Collector) routerRoutes() []*Route {
+	var routes []*Route
+	for _, handler := range c.HandlerContainer {
+		service := c.service(handler.Receiver)
+		if service == nil {
+			continue
+		}
+		routes = append(routes, &Route{
+			HandlerContainer: handler,
+			Srv:              "rt." + service.Field(),
+			Path:             service.Prefix + handler.Url,
+			Var:              "apigenRouterRoute" + handler.Receiver + handler.StructMethod,
+		})
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return lessRoute(routes[i].Path, routes[j].Path)
+	})
+	return routes
+}
+
+func hasStatic(routes []*Route) bool {
+	for _, route := range routes {
+		if !route.IsPattern() {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPatterns(routes []*Route) bool {
+	for _, route := range routes {
+		if route.IsPattern() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkServices reports the problems of the apigen:service annotations
+// and the paths that several services would serve on the Router
+func (c *Collector) checkServices() {
+	if len(c.Services) == 0 {
+		return
+	}
+
+	for _, name := range []string{"Router", "NewRouter"} {
+		if obj := c.pkg.Scope().Lookup(name); obj != nil {
+			c.errorf(obj.Pos(), "%s is generated for the apigen:service types, rename this one", name)
+		}
+	}
+
+	fields := make(map[string]*ServiceContainer)
+	for _, service := range c.Services {
+		if first, ok := fields[service.Field()]; ok {
+			c.errorf(service.Pos, "%s and %s make the same Router field %s", first.Receiver, service.Receiver, service.Field())
+			continue
+		}
+		fields[service.Field()] = service
+
+		served := false
+		for _, handler := range c.HandlerContainer {
+			served = served || handler.Receiver == service.Receiver
+		}
+		if !served {
+			c.errorf(service.Pos, "%s has no apigen:api methods to serve", service.Receiver)
+		}
+	}
+
+	seen := make(map[string]*Route)
+	for _, route := range c.routerRoutes() {
+		if c.Metrics && route.Path == metricsPath {
+			c.errorf(route.Pos, "%s is served by the metrics of -metrics", metricsPath)
+			continue
+		}
+
+		// placeholders match any segment, so /v1/{id} and /v1/{name}
+		// can't be told apart
+		key := strings.Join(route.Segments(), "/")
+		if first, ok := seen[key]; ok {
+			if first.Receiver != route.Receiver {
+				c.errorf(route.Pos, "%s collides on the Router with %s of %s.%s",
+					route.Path, first.Path, first.Receiver, first.StructMethod)
+			}
+			continue
+		}
+		seen[key] = route
+	}
+}
+
+var routerTmpl = `
+{{- range .Routes}}
+{{- if .IsPattern}}
+
+var {{.Var}} = []string{ {{- range $i, $s := .Segments}}{{if $i}}, {{end}}{{printf "%q" $s}}{{end -}} }
+{{- end}}
+{{- end}}
+
+// Router serves the apigen:service apis on a single handler,
+// each one under its prefix
+type Router struct {
+	{{- range .Services}}
+	{{.Field}} *{{.Receiver}}
+	{{- end}}
+}
+
+func NewRouter({{range $i, $s := .Services}}{{if $i}}, {{end}}{{.Field}} *{{.Receiver}}{{end}}) *Router {
+	return &Router{ {{- range $i, $s := .Services}}{{if $i}}, {{end}}{{.Field}}: {{.Field}}{{end -}} }
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	{{- template "dispatch" .Routes}}
+}
+`
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// routeSegments splits an apigen:api url like /user/{id}/profile into
+// its segments, placeholders are kept with the braces
+func routeSegments(url string) []string {
+	return strings.Split(strings.Trim(url, "/"), "/")
+}
+
+func isPlaceholder(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// PathParams returns the placeholder names of the handler url in order
+func (h *HandlerContainer) PathParams() []string {
+	var names []string
+	for _, segment := range routeSegments(h.Url) {
+		if isPlaceholder(segment) {
+			names = append(names, segment[1:len(segment)-1])
+		}
+	}
+	return names
+}
+
+// IsPattern reports whether the url has placeholders and can't be matched
+// by comparing it with the request path
+func (h *HandlerContainer) IsPattern() bool {
+	return len(h.PathParams()) > 0
+}
+
+// Segments returns the url segments as apigenMatchPath expects them,
+// with placeholders replaced by empty strings
+func (h *HandlerContainer) Segments() []string {
+	var segments []string
+	for _, segment := range routeSegments(h.Url) {
+		if isPlaceholder(segment) {
+			segment = ""
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// checkRoute verifies that the url placeholders and the fields marked
+// with the path rule of the params struct match each other
+func checkRoute(handler *HandlerContainer, params *StructContainer) error {
+	placeholders := make(map[string]bool)
+	for _, segment := range routeSegments(handler.Url) {
+		if strings.ContainsAny(segment, "{}") && !isPlaceholder(segment) {
+			return errors.Errorf("%s: placeholders must take a whole path segment", handler.Url)
+		}
+		if !isPlaceholder(segment) {
+			continue
+		}
+
+		name := segment[1 : len(segment)-1]
+		if name == "" || placeholders[name] {
+			return errors.Errorf("%s: empty or repeated placeholder %q", handler.Url, segment)
+		}
+		placeholders[name] = true
+	}
+
+	for _, field := range params.Fields {
+		if !field.Path {
+			continue
+		}
+		if !placeholders[field.ParamName] {
+			return errors.Errorf("%s.%s: no {%s} in %s", params.Name, field.FieldName, field.ParamName, handler.Url)
+		}
+		delete(placeholders, field.ParamName)
+	}
+
+	for name := range placeholders {
+		return errors.Errorf("%s: no %s field is marked with apivalidator:\"path\"", handler.Url, name)
+	}
+
+	return nil
+}
+
+// sortRoutes orders the handlers by url, see lessRoute
+func sortRoutes(handlers []*HandlerContainer) {
+	sort.SliceStable(handlers, func(i, j int) bool {
+		return lessRoute(handlers[i].Url, handlers[j].Url)
+	})
+}
+
+// lessRoute orders the urls putting literal segments before placeholders
+// so that /user/me is tried before /user/{id}
+func lessRoute(x, y string) bool {
+	a, b := routeSegments(x), routeSegments(y)
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if isPlaceholder(a[k]) != isPlaceholder(b[k]) {
+			return !isPlaceholder(a[k])
+		}
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// parseResponse checks the response mode of the annotation against
+// the method result: io.Reader results are written as raw bytes and
+// channels are streamed item by item as ndjson or server-sent events
+func (h *HandlerContainer) parseResponse(result types.Type, qualifier types.Qualifier) error {
+	if ch, ok := types.Unalias(result).Underlying().(*types.Chan); ok {
+		if ch.Dir() == types.SendOnly {
+			return errors.Errorf("can't stream the send-only %s", types.TypeString(result, qualifier))
+		}
+		switch h.Response {
+		case "":
+			h.Response = "ndjson"
+		case "ndjson", "sse":
+		default:
+			return errors.Errorf("channel results are streamed as ndjson or sse, not %q", h.Response)
+		}
+		h.StreamElem = types.TypeString(ch.Elem(), qualifier)
+	} else if isNamed(result, "io", "Reader") || isNamed(result, "io", "ReadCloser") {
+		switch h.Response {
+		case "":
+			h.Response = "raw"
+		case "raw":
+		default:
+			return errors.Errorf("%s results are written as raw, not %q", types.TypeString(result, qualifier), h.Response)
+		}
+	} else if h.Response != "" {
+		return errors.Errorf("response %q needs an io.Reader or a channel result", h.Response)
+	}
+
+	if h.ContentType != "" && h.Response != "raw" {
+		return errors.New("content_type is only supported for io.Reader results")
+	}
+	if h.Response == "raw" && h.ContentType == "" {
+		h.ContentType = "application/octet-stream"
+	}
+
+	return nil
+}
+
+// IsStream reports whether the result is a channel streamed to the client
+func (h *HandlerContainer) IsStream() bool {
+	return h.Response == "ndjson" || h.Response == "sse"
+}
+
+// setFileType recognizes the fields receiving uploaded files, the file
+// header itself or its content passed as io.Reader
+func (field *StructField) setFileType(t types.Type) bool {
+	switch {
+	case field.Pointer && isNamed(t, "mime/multipart", "FileHeader"):
+		field.File = "header"
+	case !field.Pointer && !field.Slice && isNamed(t, "io", "Reader"):
+		field.File = "reader"
+	default:
+		return false
+	}
+	return true
+}
+
+// parseSize reads a maxsize value in bytes, KB, MB and GB are powers of 1024
+func parseSize(value string) (string, error) {
+	multiplier := int64(1)
+	for i, suffix := range []string{"KB", "MB", "GB"} {
+		if strings.HasSuffix(value, suffix) {
+			multiplier = 1 << (10 * uint(i+1))
+			value = strings.TrimSuffix(value, suffix)
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return "", errors.Errorf("maxsize=%s is not a size", value)
+	}
+	return strconv.FormatInt(size*multiplier, 10), nil
+}
+
+// HasFiles reports whether the params receive uploaded files,
+// which are sent as multipart/form-data
+func (s *StructContainer) HasFiles() bool {
+	for _, field := range s.Fields {
+		if field.File != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// MultipartFunc names the function filling params of another package
+// from a multipart form
+func (s *StructContainer) MultipartFunc() string {
+	return strings.Replace(s.FillFunc(), "apigenFill", "apigenFillMultipart", 1)
+}
+
+// HasUploads reports whether some params receive uploaded files
+func (c *Collector) HasUploads() bool {
+	for _, structContainer := range c.StructContainer {
+		if structContainer.HasFiles() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasResponse reports whether some endpoint uses the response mode
+func (c *Collector) HasResponse(modes ...string) bool {
+	for _, handler := range c.HandlerContainer {
+		for _, mode := range modes {
+			if handler.Response == mode {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"context"
+)
+
+type Address struct {
+	City string `apivalidator:"required"`
+	Zip  string `apivalidator:"len=6"`
+}
+
+type Paging struct {
+	Limit  int `apivalidator:"default=10,max=100"`
+	Offset int `apivalidator:"min=0"`
+}
+
+// SearchParams has the fields the params are flattened from:
+// embedded, nested, pointer, slice and multi-name ones
+type SearchParams struct {
+	Paging
+	Home        Address  `apivalidator:"paramname=address"`
+	Work        Address  `apivalidator:""`
+	Age         *int     `apivalidator:"min=18"`
+	Tags        []string `apivalidator:"max=3"`
+	First, Last string   `apivalidator:"required"`
+}
+
+type SearchApi struct{}
+
+// apigen:api {"url": "/search"}
+func (srv *SearchApi) Search(ctx context.Context, in SearchParams) (*SearchParams, error) {
+	return &in, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestFillFrom(t *testing.T) {
+	q := url.Values{
+		"address.city": {"Moscow"},
+		"address.zip":  {"101000"},
+		"work.city":    {"Paris"},
+		"work.zip":     {"750001"},
+		"offset":       {"20"},
+		"tags":         {"a", "b"},
+		"first":        {"Ivan"},
+		"last":         {"Ivanov"},
+	}
+
+	p := SearchParams{}
+	if err := p.FillFrom(q); err != nil {
+		t.Fatal(err)
+	}
+	if p.Home.City != "Moscow" || p.Home.Zip != "101000" || p.Work.City != "Paris" {
+		t.Errorf("nested fields: %#v %#v", p.Home, p.Work)
+	}
+	if p.Limit != 10 || p.Offset != 20 {
+		t.Errorf("embedded fields: %#v", p.Paging)
+	}
+	if p.Age != nil {
+		t.Errorf("absent age: got %d", *p.Age)
+	}
+	if len(p.Tags) != 2 || p.First != "Ivan" || p.Last != "Ivanov" {
+		t.Errorf("got %#v", p)
+	}
+
+	q.Set("age", "20")
+	if err := p.FillFrom(q); err != nil || p.Age == nil || *p.Age != 20 {
+		t.Errorf("age: %v", err)
+	}
+
+	for param, want := range map[string]string{
+		"address.city": "address.city must me not empty",
+		"work.city":    "work.city must me not empty",
+		"last":         "last must me not empty",
+	} {
+		bad := url.Values{}
+		for k, v := range q {
+			bad[k] = v
+		}
+		bad.Del(param)
+		if err := (&SearchParams{}).FillFrom(bad); err == nil || err.Error() != want {
+			t.Errorf("without %s: got %v, want %s", param, err, want)
+		}
+	}
+
+	for param, value := range map[string]string{
+		"address.zip": "1010",
+		"age":         "17",
+		"limit":       "101",
+	} {
+		bad := url.Values{}
+		for k, v := range q {
+			bad[k] = v
+		}
+		bad.Set(param, value)
+		if err := (&SearchParams{}).FillFrom(bad); err == nil {
+			t.Errorf("%s=%s: no error", param, value)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	ts := httptest.NewServer(&SearchApi{})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/search?address.city=Moscow&work.city=Paris&work.zip=750001&address.zip=101000&first=Ivan&last=Ivanov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Response map[string]interface{} `json:"response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Response["Age"] != nil || body.Response["Limit"] != 10.0 {
+		t.Errorf("got %d %v", resp.StatusCode, body.Response)
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"apigentest/models"
+	"context"
+	"time"
+)
+
+type Status string
+
+type User struct {
+	ID      uint             `json:"id"`
+	Name    string           `json:"name"`
+	Status  Status           `json:"status"`
+	Created time.Time        `json:"created"`
+	Scores  map[string]int   `json:"scores"`
+	Avatar  []byte           `json:"avatar,omitempty"`
+	Manager *User            `json:"manager"`
+	Home    models.Address   `json:"home"`
+	Visited []models.Address `json:"visited"`
+	models.Audit
+
+	secret string
+}
+
+// Profile is the User under another name
+type Profile = User
+
+type UserParams struct {
+	ID     uint     `apivalidator:"path"`
+	Fields []string `apivalidator:"enum=name|email"`
+}
+
+type ListParams struct {
+	Status string `apivalidator:"enum=active|banned,default=active"`
+	Limit  int    `apivalidator:"default=10,min=1,max=100"`
+	Email  string `apivalidator:"required,email"`
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/users/{id}", "method": "GET"}
+func (srv *Api) Get(ctx context.Context, in UserParams) (*Profile, error) {
+	return &Profile{ID: in.ID, secret: "-"}, nil
+}
+
+// apigen:api {"url": "/users", "method": "POST", "auth": true}
+func (srv *Api) List(ctx context.Context, in ListParams) ([]models.Address, error) {
+	return nil, nil
+}
@@ -0,0 +1,10 @@
+package models
+
+type Address struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type Audit struct {
+	CreatedBy string `json:"created_by"`
+}
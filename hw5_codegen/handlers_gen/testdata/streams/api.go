@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"strings"
+)
+
+type Api struct{}
+
+type AvatarParams struct {
+	User   string                `apivalidator:"path"`
+	Avatar *multipart.FileHeader `apivalidator:"required,maxsize=1KB"`
+	Note   string                `apivalidator:"max=10"`
+}
+
+type ImportParams struct {
+	Data io.Reader `apivalidator:"paramname=file"`
+}
+
+type ExportParams struct {
+	Format string `apivalidator:"enum=csv|txt,default=csv"`
+}
+
+type Event struct {
+	N int `json:"n"`
+}
+
+type FeedParams struct {
+	Count int `apivalidator:"min=0,max=5"`
+}
+
+// apigen:api {"url": "/user/{user}/avatar", "method": "POST"}
+func (a *Api) Avatar(ctx context.Context, in AvatarParams) (string, error) {
+	return in.User + ":" + in.Avatar.Filename + ":" + in.Note, nil
+}
+
+// apigen:api {"url": "/import", "method": "POST"}
+func (a *Api) Import(ctx context.Context, in ImportParams) (int, error) {
+	if in.Data == nil {
+		return -1, nil
+	}
+	data, err := io.ReadAll(in.Data)
+	return len(data), err
+}
+
+// apigen:api {"url": "/export", "content_type": "text/csv"}
+func (a *Api) Export(ctx context.Context, in ExportParams) (io.Reader, error) {
+	return strings.NewReader("a,b\n1,2\n"), nil
+}
+
+// apigen:api {"url": "/feed"}
+func (a *Api) Feed(ctx context.Context, in FeedParams) (<-chan Event, error) {
+	return events(ctx, in.Count), nil
+}
+
+// apigen:api {"url": "/events", "response": "sse", "timeout": "1s"}
+func (a *Api) Events(ctx context.Context, in FeedParams) (<-chan Event, error) {
+	return events(ctx, in.Count), nil
+}
+
+func events(ctx context.Context, count int) <-chan Event {
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		for i := 0; i < count; i++ {
+			select {
+			case ch <- Event{N: i}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// upload posts a multipart form with the fields and, unless param is empty,
+// a file of size bytes
+func upload(url, param string, size int, fields map[string]string) (int, string) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for k, v := range fields {
+		form.WriteField(k, v)
+	}
+	if param != "" {
+		part, _ := form.CreateFormFile(param, "f.png")
+		part.Write(make([]byte, size))
+	}
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, url, body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	(&Api{}).ServeHTTP(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestUploads(t *testing.T) {
+	cases := []struct {
+		url    string
+		param  string
+		size   int
+		fields map[string]string
+		status int
+		want   string
+	}{
+		{"/user/bob/avatar", "avatar", 10, map[string]string{"note": "hi"}, http.StatusOK, `"response":"bob:f.png:hi"`},
+		{"/user/bob/avatar", "avatar", 2000, nil, http.StatusBadRequest, `"error":"avatar must be at most 1024 bytes"`},
+		{"/user/bob/avatar", "", 0, nil, http.StatusBadRequest, `"error":"avatar must me not empty"`},
+		{"/user/bob/avatar", "avatar", 10, map[string]string{"note": "a very long note"}, http.StatusBadRequest, `"error":"note len must be \u003c= 10"`},
+		{"/import", "file", 5000, nil, http.StatusOK, `"response":5000`},
+		{"/import", "", 0, nil, http.StatusOK, `"response":-1`},
+		{"/import", "file", 2 << 20, nil, http.StatusRequestEntityTooLarge, `"error"`},
+	}
+
+	for _, c := range cases {
+		status, got := upload(c.url, c.param, c.size, c.fields)
+		if status != c.status || !strings.Contains(got, c.want) {
+			t.Errorf("%s %s of %d bytes: got %d %s, want %d %s", c.url, c.param, c.size, status, got, c.status, c.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/import", strings.NewReader("a=b"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	(&Api{}).ServeHTTP(w, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("form body: got %d, want 415", w.Code)
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	var p AvatarParams
+	if err := p.Validate(); err == nil || err.Error() != "avatar must me not empty" {
+		t.Errorf("no avatar: %v", err)
+	}
+	p.Avatar = &multipart.FileHeader{Size: 5000}
+	if err := p.Validate(); err == nil || err.Error() != "avatar must be at most 1024 bytes" {
+		t.Errorf("large avatar: %v", err)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	ts := httptest.NewServer(&Api{})
+	defer ts.Close()
+
+	cases := []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/export", http.StatusOK, "text/csv", "a,b\n1,2\n"},
+		{"/feed?count=3", http.StatusOK, "application/x-ndjson", "{\"n\":0}\n{\"n\":1}\n{\"n\":2}\n"},
+		{"/events?count=2", http.StatusOK, "text/event-stream", "data: {\"n\":0}\n\ndata: {\"n\":1}\n\n"},
+		{"/feed?count=9", http.StatusBadRequest, "application/json", `{"error":"count must be \u003c= 5"}` + "\n"},
+	}
+
+	for _, c := range cases {
+		resp, err := http.Get(ts.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.status || resp.Header.Get("Content-Type") != c.contentType || string(data) != c.body {
+			t.Errorf("%s: got %d %s %q", c.path, resp.StatusCode, resp.Header.Get("Content-Type"), data)
+		}
+	}
+}
+
+func TestStreamsClient(t *testing.T) {
+	ts := httptest.NewServer(&Api{})
+	defer ts.Close()
+	client := NewApiClient(ts.URL)
+	ctx := context.Background()
+
+	n, err := client.Import(ctx, ImportParams{Data: strings.NewReader("hello")})
+	if err != nil || n != 5 {
+		t.Errorf("import: got %v %v", n, err)
+	}
+
+	body, err := client.Export(ctx, ExportParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(body)
+	if string(data) != "a,b\n1,2\n" {
+		t.Errorf("export: got %q", data)
+	}
+
+	for _, stream := range []func(context.Context, FeedParams) (<-chan Event, error){client.Feed, client.Events} {
+		items, err := stream(ctx, FeedParams{Count: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for item := range items {
+			got = append(got, item.N)
+		}
+		if len(got) != 4 || got[3] != 3 {
+			t.Errorf("stream: got %v", got)
+		}
+	}
+
+	if _, err := client.Feed(ctx, FeedParams{Count: 7}); err == nil || !strings.Contains(err.Error(), "count must be <= 5") {
+		t.Errorf("feed error: %v", err)
+	}
+}
@@ -0,0 +1,803 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"go/types"
+	"math"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// testAuthToken is the X-Auth value apigenAuthorize accepts
+const testAuthToken = "100500"
+
+// formatSamples are valid values of the email, url and uuid rules
+var formatSamples = map[string]string{
+	"email": "user@example.com",
+	"url":   "https://example.com",
+	"uuid":  "123e4567-e89b-12d3-a456-426614174000",
+}
+
+// TestParam is a request param sent by a generated test case
+type TestParam struct {
+	Name   string
+	Values []string
+}
+
+// TestCase is a request derived from the apivalidator tags. It must fail
+// validation with Message, or be answered with Status and Error, or
+// otherwise pass the validation of the Pass params
+type TestCase struct {
+	Name    string
+	Method  string
+	Path    string
+	Params  []*TestParam
+	Auth    bool
+	Status  int
+	Error   string
+	Message string
+}
+
+// TestDefault checks that a missing param is filled with its default
+type TestDefault struct {
+	Field  *StructField
+	Params []*TestParam
+}
+
+// TestHandler holds the generated tests of an endpoint
+type TestHandler struct {
+	*HandlerContainer
+	Server   string
+	Cases    []*TestCase
+	Defaults []*TestDefault
+}
+
+// testValues returns request values passing the rules of the field, nil
+// when it can be left out. ok is false when they can't be derived from
+// the tags. Fields with cross-field rules are left out, their zero values
+// are compared by the rules
+func testValues(field *StructField) (values []string, ok bool) {
+	required := field.Required || field.Path
+	if field.File != "" || len(field.Compare) > 0 && required {
+		return nil, false
+	}
+	if len(field.Compare) > 0 {
+		return nil, true
+	}
+
+	if !field.Slice {
+		if !required && (field.Pointer || field.HasDefault) {
+			return nil, true
+		}
+		value, ok := testValue(field, field.Min, field.Max, field.Len, required)
+		if !ok || value == "" {
+			return nil, ok
+		}
+		return []string{value}, true
+	}
+
+	count := 0
+	for _, bound := range []string{field.Len, field.Min} {
+		if n, err := strconv.Atoi(bound); err == nil && bound != "" {
+			count = n
+			break
+		}
+	}
+	if count == 0 && required {
+		count = 1
+	}
+	if count == 0 {
+		return nil, true
+	}
+
+	// min, max and len bound the number of values of slices
+	value, ok := testValue(field, "", "", "", true)
+	if !ok {
+		return nil, false
+	}
+	for i := 0; i < count; i++ {
+		values = append(values, value)
+	}
+	return values, true
+}
+
+// testValue returns a single value passing the rules of the field within
+// the given bounds, empty when the zero value does
+func testValue(field *StructField, min, max, length string, required bool) (string, bool) {
+	if len(field.Enum) > 0 {
+		return field.Enum[0], true
+	}
+
+	switch field.BaseType {
+	case "string":
+		if field.Pattern != "" {
+			if !required && min == "" && length == "" {
+				return "", true
+			}
+			sample, ok := patternSample(field.Pattern)
+			if !ok || length != "" && strconv.Itoa(len(sample)) != length || !inRange(float64(len(sample)), min, max) {
+				return "", false
+			}
+			return sample, true
+		}
+		if sample, ok := formatSamples[field.Format]; ok {
+			if length != "" && strconv.Itoa(len(sample)) != length || !inRange(float64(len(sample)), min, max) {
+				return "", false
+			}
+			return sample, true
+		}
+
+		n := 0
+		if required {
+			n = 1
+		}
+		for _, bound := range []string{length, min} {
+			if v, err := strconv.Atoi(bound); err == nil && bound != "" {
+				n = v
+				break
+			}
+		}
+		if !inRange(float64(n), min, max) {
+			return "", false
+		}
+		return strings.Repeat("a", n), true
+
+	case "bool", "time.Time":
+		if !required {
+			return "", true
+		}
+		if field.BaseType == "bool" {
+			return "true", true
+		}
+		return "2006-01-02T15:04:05Z", true
+	}
+
+	value := "0"
+	if required {
+		value = "1"
+	}
+	if v, _ := strconv.ParseFloat(value, 64); !inRange(v, min, "") {
+		value = min
+	} else if !inRange(v, "", max) {
+		value = max
+	}
+	if v, _ := strconv.ParseFloat(value, 64); required && v == 0 || !inRange(v, min, max) {
+		return "", false
+	}
+	if value == "0" {
+		return "", true
+	}
+	return value, true
+}
+
+// patternSample builds the shortest string matching the regexp,
+// taking the first branch of alternations and the first char of classes
+func patternSample(expr string) (string, bool) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	var b strings.Builder
+	var walk func(re *syntax.Regexp)
+	walk = func(re *syntax.Regexp) {
+		switch re.Op {
+		case syntax.OpLiteral:
+			b.WriteString(string(re.Rune))
+		case syntax.OpCharClass:
+			if len(re.Rune) > 0 {
+				b.WriteRune(re.Rune[0])
+			}
+		case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+			b.WriteRune('a')
+		case syntax.OpCapture, syntax.OpPlus:
+			walk(re.Sub[0])
+		case syntax.OpRepeat:
+			for i := 0; i < re.Min; i++ {
+				walk(re.Sub[0])
+			}
+		case syntax.OpConcat:
+			for _, sub := range re.Sub {
+				walk(sub)
+			}
+		case syntax.OpAlternate:
+			walk(re.Sub[0])
+		}
+	}
+	walk(re.Simplify())
+
+	sample := b.String()
+	matched, err := regexp.MatchString(expr, sample)
+	return sample, err == nil && matched && sample != ""
+}
+
+// patternMiss returns a value the regexp doesn't match
+func patternMiss(expr string) (string, bool) {
+	for _, candidate := range []string{"!", "0", "a", "A", " ", "!!!!!!!!"} {
+		if matched, err := regexp.MatchString(expr, candidate); err == nil && !matched {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// inRange reports whether v is within the optional bounds
+func inRange(v float64, min, max string) bool {
+	if lo, err := strconv.ParseFloat(min, 64); err == nil && v < lo {
+		return false
+	}
+	if hi, err := strconv.ParseFloat(max, 64); err == nil && v > hi {
+		return false
+	}
+	return true
+}
+
+// testHandler derives the test cases of the endpoint from its params
+func (c *Collector) testHandler(handler *HandlerContainer) *TestHandler {
+	th := &TestHandler{
+		HandlerContainer: handler,
+		Server:           "&" + handler.Receiver + "{}",
+	}
+	if fn, ok := c.pkg.Scope().Lookup("New" + handler.Receiver).(*types.Func); ok {
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() == 0 && sig.Results().Len() == 1 &&
+			types.Identical(sig.Results().At(0).Type(), types.NewPointer(c.pkg.Scope().Lookup(handler.Receiver).Type())) {
+			th.Server = fn.Name() + "()"
+		}
+	}
+
+	method := handler.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	fields := handler.Struct.Fields
+
+	if handler.Method != "" {
+		wrong := http.MethodPost
+		if handler.Method == http.MethodPost {
+			wrong = http.MethodGet
+		}
+		th.Cases = append(th.Cases, &TestCase{
+			Name:   "wrong method",
+			Method: wrong,
+			Path:   testPath(handler.Url, nil),
+			Status: http.StatusNotAcceptable,
+			Error:  "bad method",
+		})
+	}
+
+	// custom authorizers take credentials the tests can't know
+	customAuth := c.Methods[handler.Receiver+".Authorize"]
+	if handler.Auth && customAuth {
+		return th
+	}
+	if handler.Auth {
+		th.Cases = append(th.Cases, &TestCase{
+			Name:   "missing auth",
+			Method: method,
+			Path:   testPath(handler.Url, nil),
+			Status: http.StatusForbidden,
+			Error:  "unauthorized",
+		})
+	}
+
+	// rate limits by token would be hit by the cases sharing it
+	if handler.Rate != "" && handler.RateKey == "auth" || handler.Struct.HasFiles() {
+		return th
+	}
+
+	valid := make(map[*StructField][]string)
+	for _, field := range fields {
+		values, ok := testValues(field)
+		if !ok {
+			return th
+		}
+		valid[field] = values
+	}
+
+	// with replaces the values of a field in the valid request,
+	// nil leaves the param out
+	with := func(field *StructField, values []string) []*TestParam {
+		var params []*TestParam
+		for _, f := range fields {
+			v := valid[f]
+			if f == field {
+				v = values
+			}
+			if v != nil {
+				params = append(params, &TestParam{Name: f.ParamName, Values: v})
+			}
+		}
+		return params
+	}
+
+	if breaksCompare(fields, with(nil, nil)) {
+		return th
+	}
+
+	add := func(name string, field *StructField, values []string, message string) {
+		if field.Path && (len(values) == 0 || values[0] == "") {
+			// the route doesn't match without the segment
+			return
+		}
+		tc := &TestCase{
+			Name:    field.ParamName + " " + name,
+			Method:  method,
+			Auth:    handler.Auth,
+			Message: message,
+		}
+		all := with(field, values)
+		if message == "" && breaksCompare(fields, all) {
+			return
+		}
+		tc.Path = testPath(handler.Url, all)
+		for _, p := range all {
+			if !isPathParam(fields, p.Name) {
+				tc.Params = append(tc.Params, p)
+			}
+		}
+		th.Cases = append(th.Cases, tc)
+	}
+
+	base := &TestCase{Name: "valid", Method: method, Auth: handler.Auth}
+	for _, p := range with(nil, nil) {
+		if !isPathParam(fields, p.Name) {
+			base.Params = append(base.Params, p)
+		}
+	}
+	base.Path = testPath(handler.Url, with(nil, nil))
+	th.Cases = append(th.Cases, base)
+
+	for _, field := range fields {
+		name := field.ParamName
+		// repeat puts the value in place of the first valid one,
+		// keeping the number of values of slices
+		repeat := func(value string) []string {
+			values := append([]string{}, valid[field]...)
+			if len(values) == 0 {
+				return []string{value}
+			}
+			values[0] = value
+			return values
+		}
+
+		if field.Required && !field.HasDefault {
+			add("missing", field, nil, name+" must me not empty")
+		}
+		if field.HasDefault && !breaksCompare(fields, with(field, nil)) {
+			add("default", field, nil, "")
+			th.Defaults = append(th.Defaults, &TestDefault{Field: field, Params: with(field, nil)})
+		}
+
+		if field.BaseType != "string" {
+			typeName := field.BaseType
+			if field.Slice {
+				typeName = field.FieldType
+			}
+			add("not "+field.BaseType, field, repeat("x"), name+" must be "+typeName)
+		}
+
+		if len(field.Enum) > 0 {
+			for _, value := range field.Enum {
+				add("= "+value, field, repeat(value), "")
+			}
+			add("not in enum", field, repeat(notInEnum(field)), name+" must be one of ["+strings.Join(field.Enum, ", ")+"]")
+		}
+
+		if len(field.Compare) > 0 {
+			continue
+		}
+
+		if field.Pattern != "" && len(field.Enum) == 0 {
+			if sample, ok := patternSample(field.Pattern); ok && (field.Len == "" || strconv.Itoa(len(sample)) == field.Len) && inRange(float64(len(sample)), field.Min, field.Max) {
+				add("matches", field, repeat(sample), "")
+			}
+			if miss, ok := patternMiss(field.Pattern); ok {
+				add("not matching", field, repeat(miss), name+" must match "+field.Pattern)
+			}
+		}
+
+		if sample, ok := formatSamples[field.Format]; ok && len(field.Enum) == 0 {
+			add("is "+field.Format, field, repeat(sample), "")
+			add("not "+field.Format, field, repeat("not-"+field.Format), name+" must be "+field.Format)
+		}
+
+		if field.Slice {
+			element, _ := testValue(field, "", "", "", true)
+			counts := func(n int) []string {
+				return strings.Split(strings.Repeat(element+"\x00", n), "\x00")[:n]
+			}
+			testBounds(field, true, func(label string, n float64, message string) {
+				if n == 0 && field.Required {
+					return
+				}
+				add(label, field, counts(int(n)), message)
+			})
+			continue
+		}
+		if len(field.Enum) > 0 || field.Pattern != "" || field.Format != "" {
+			continue
+		}
+		switch field.BaseType {
+		case "string":
+			testBounds(field, true, func(label string, n float64, message string) {
+				if n == 0 && field.Required {
+					return
+				}
+				add(label, field, []string{strings.Repeat("a", int(n))}, message)
+			})
+		case "int", "int64", "uint", "float64":
+			testBounds(field, false, func(label string, n float64, message string) {
+				if n < 0 && field.BaseType == "uint" || n == 0 && field.Required && !field.Pointer {
+					return
+				}
+				add(label, field, []string{strconv.FormatFloat(n, 'f', -1, 64)}, message)
+			})
+		}
+	}
+
+	return th
+}
+
+// breaksCompare reports whether the request params break a cross-field
+// or required_if rule, left out params are compared by their defaults or zero values
+// and the ones that can't be parsed break the rules
+func breaksCompare(fields []*StructField, params []*TestParam) bool {
+	value := func(field *StructField) string {
+		for _, p := range params {
+			if p.Name == field.ParamName && len(p.Values) > 0 && p.Values[0] != "" {
+				return p.Values[0]
+			}
+		}
+		return field.Default
+	}
+
+	for _, field := range fields {
+		for _, rule := range field.Compare {
+			if rule.Rule == "required_if" {
+				if value(rule.Other) == rule.Value && value(field) == "" {
+					return true
+				}
+				continue
+			}
+			if !holds(rule.Rule, field.BaseType, value(field), value(rule.Other)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// holds evaluates the cross-field rule for the request values a and b
+func holds(rule, baseType, a, b string) bool {
+	var order int
+	switch baseType {
+	case "string":
+		order = strings.Compare(a, b)
+	case "bool":
+		x, errA := strconv.ParseBool(cmp.Or(a, "false"))
+		y, errB := strconv.ParseBool(cmp.Or(b, "false"))
+		if errA != nil || errB != nil {
+			return false
+		}
+		if x != y {
+			order = 1
+		}
+	case "time.Time":
+		var x, y time.Time
+		var errA, errB error
+		if a != "" {
+			x, errA = time.Parse(time.RFC3339, a)
+		}
+		if b != "" {
+			y, errB = time.Parse(time.RFC3339, b)
+		}
+		if errA != nil || errB != nil {
+			return false
+		}
+		order = x.Compare(y)
+	default:
+		x, errA := strconv.ParseFloat(cmp.Or(a, "0"), 64)
+		y, errB := strconv.ParseFloat(cmp.Or(b, "0"), 64)
+		if errA != nil || errB != nil {
+			return false
+		}
+		order = cmp.Compare(x, y)
+	}
+
+	switch rule {
+	case "gtfield":
+		return order > 0
+	case "gtefield":
+		return order >= 0
+	case "ltfield":
+		return order < 0
+	case "ltefield":
+		return order <= 0
+	case "eqfield":
+		return order == 0
+	default:
+		return order != 0
+	}
+}
+
+// testBounds calls add with the values below, at and above the min, max
+// and len rules, which are lengths for strings and slices
+func testBounds(field *StructField, length bool, add func(label string, n float64, message string)) {
+	what := " must be "
+	if length {
+		what = " len must be "
+	}
+	step := 1.0
+	if field.BaseType == "float64" && !length {
+		step = 0.5
+	}
+
+	if min, err := strconv.ParseFloat(field.Min, 64); err == nil {
+		if !length || min > 0 {
+			add("below min", min-step, field.ParamName+what+">= "+field.Min)
+		}
+		add("at min", min, "")
+	}
+	if max, err := strconv.ParseFloat(field.Max, 64); err == nil {
+		add("at max", max, "")
+		add("above max", max+step, field.ParamName+what+"<= "+field.Max)
+	}
+	if n, err := strconv.Atoi(field.Len); err == nil {
+		if n > 0 {
+			add("shorter", float64(n-1), field.ParamName+" len must be "+field.Len)
+		}
+		add("at len", float64(n), "")
+		add("longer", float64(n+1), field.ParamName+" len must be "+field.Len)
+	}
+}
+
+// notInEnum returns a value of the field type missing from the enum
+func notInEnum(field *StructField) string {
+	in := make(map[string]bool)
+	top := math.Inf(-1)
+	for _, value := range field.Enum {
+		in[value] = true
+		if v, err := strconv.ParseFloat(value, 64); err == nil && v > top {
+			top = v
+		}
+	}
+	if field.BaseType != "string" {
+		return strconv.FormatFloat(math.Floor(top)+1, 'f', -1, 64)
+	}
+
+	value := "invalid"
+	for in[value] {
+		value += "_"
+	}
+	return value
+}
+
+func isPathParam(fields []*StructField, name string) bool {
+	for _, field := range fields {
+		if field.Path && field.ParamName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// testPath fills the url placeholders with the path params
+func testPath(url string, params []*TestParam) string {
+	segments := routeSegments(url)
+	for i, segment := range segments {
+		if !isPlaceholder(segment) {
+			continue
+		}
+		segments[i] = "1"
+		for _, p := range params {
+			if "{"+p.Name+"}" == segment && len(p.Values) > 0 {
+				segments[i] = pathEscape(p.Values[0])
+			}
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func pathEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "/", "%2F", "?", "%3F", "#", "%23", " ", "%20").Replace(s)
+}
+
+// RenderTests writes table driven tests of the endpoints against the
+// generated ServeHTTP, the cases are derived from the apivalidator tags
+func RenderTests() ([]byte, error) {
+	container := GetCollector()
+
+	imports := map[string]bool{
+		"context":           true,
+		"encoding/json":     true,
+		"fmt":               true,
+		"io":                true,
+		"net/http":          true,
+		"net/http/httptest": true,
+		"net/url":           true,
+		"strings":           true,
+		"testing":           true,
+		"time":              true,
+	}
+
+	var handlers []*TestHandler
+	for _, rh := range container.receiverHandlers() {
+		for _, handler := range rh.Handler {
+			th := container.testHandler(handler)
+			if len(th.Defaults) > 0 {
+				for _, spec := range container.typeImports(handler.ParamType) {
+					imports[spec] = true
+				}
+			}
+			handlers = append(handlers, th)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	err := testsTmpl.Execute(out, map[string]interface{}{
+		"Handlers": handlers,
+		"Token":    testAuthToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return renderGoFile(container.Package, sortedKeys(imports), out.Bytes())
+}
+
+var testsTmpl = template.Must(template.New("tests").Funcs(template.FuncMap{
+	"literal": literal,
+	"status": func(code int) string {
+		return map[int]string{
+			http.StatusForbidden:     "http.StatusForbidden",
+			http.StatusNotAcceptable: "http.StatusNotAcceptable",
+		}[code]
+	},
+}).Parse(`
+// apigenTestCase is a request built from the apivalidator tags: it fails
+// validation with message, or gets status and err, or else it is valid
+type apigenTestCase struct {
+	name    string
+	method  string
+	path    string
+	params  url.Values
+	auth    bool
+	status  int
+	err     string
+	message string
+}
+
+// apigenValidStatus holds the statuses valid requests get instead of 2xx
+// by the business logic, like 404 for unknown users, keyed by
+// Receiver.Method; fill it from the init func of a hand-written test
+var apigenValidStatus = map[string]int{}
+
+func apigenRunTests(t *testing.T, endpoint string, handler http.Handler, cases []apigenTestCase) {
+	t.Helper()
+	for i, tc := range cases {
+		i, tc := i, tc
+		t.Run(tc.name, func(t *testing.T) {
+			var body io.Reader
+			target := tc.path
+			if tc.method == http.MethodGet {
+				target += "?" + tc.params.Encode()
+			} else {
+				body = strings.NewReader(tc.params.Encode())
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			req := httptest.NewRequest(tc.method, target, body).WithContext(ctx)
+			if body != nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tc.auth {
+				req.Header.Set("X-Auth", {{printf "%q" .Token}})
+			}
+			// the cases come from different addresses to stay under the rate limits
+			req.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			var resp struct {
+				Error  string ` + "`json:\"error\"`" + `
+				Fields []struct {
+					Message string ` + "`json:\"message\"`" + `
+				} ` + "`json:\"fields\"`" + `
+			}
+			_ = json.NewDecoder(rec.Body).Decode(&resp)
+			var messages []string
+			if rec.Code == http.StatusBadRequest {
+				for _, field := range resp.Fields {
+					messages = append(messages, field.Message)
+				}
+				if len(resp.Fields) == 0 {
+					messages = append(messages, resp.Error)
+				}
+			}
+
+			switch {
+			case tc.message != "":
+				for _, message := range messages {
+					if message == tc.message {
+						return
+					}
+				}
+				t.Errorf("%s %s: got %d %q, want 400 %q", tc.method, target, rec.Code, messages, tc.message)
+			case tc.status != 0:
+				if rec.Code != tc.status || resp.Error != tc.err {
+					t.Errorf("%s %s: got %d %q, want %d %q", tc.method, target, rec.Code, resp.Error, tc.status, tc.err)
+				}
+			default:
+				if want, ok := apigenValidStatus[endpoint]; rec.Code/100 != 2 && (!ok || rec.Code != want) {
+					t.Errorf("%s %s: got %d %q, want 2xx or the status of apigenValidStatus", tc.method, target, rec.Code, resp.Error)
+				}
+			}
+		})
+	}
+}
+
+{{- range .Handlers}}
+
+func TestApigen{{.Receiver}}{{.StructMethod}}(t *testing.T) {
+	apigenRunTests(t, {{printf "%q" (print .Receiver "." .StructMethod)}}, {{.Server}}, []apigenTestCase{
+		{{- range .Cases}}
+		{
+			name:   {{printf "%q" .Name}},
+			method: {{printf "%q" .Method}},
+			path:   {{printf "%q" .Path}},
+			{{- if .Params}}
+			params: url.Values{ {{- template "values" .Params}} },
+			{{- end}}
+			{{- if .Auth}}
+			auth:   true,
+			{{- end}}
+			{{- if .Status}}
+			status: {{status .Status}},
+			err:    {{printf "%q" .Error}},
+			{{- end}}
+			{{- if .Message}}
+			message: {{printf "%q" .Message}},
+			{{- end}}
+		},
+		{{- end}}
+	})
+	{{- $handler := .}}
+	{{- range .Defaults}}
+
+	t.Run({{printf "%q" (print "default " .Field.ParamName)}}, func(t *testing.T) {
+		p := {{$handler.Param}}{}
+		q := url.Values{ {{- template "values" .Params}} }
+		{{- if $handler.Struct.Local}}
+		if err := p.FillFrom(q); err != nil {
+		{{- else}}
+		if err := {{$handler.Struct.FillFunc}}(&p, q); err != nil {
+		{{- end}}
+			t.Fatal(err)
+		}
+		{{- if .Field.Pointer}}
+		if p.{{.Field.FieldName}} == nil || *p.{{.Field.FieldName}} != {{literal .Field .Field.Default}} {
+			t.Errorf("{{.Field.ParamName}} is %v, want the default {{.Field.Default}}", p.{{.Field.FieldName}})
+		}
+		{{- else}}
+		if p.{{.Field.FieldName}} != {{literal .Field .Field.Default}} {
+			t.Errorf("{{.Field.ParamName}} is %v, want the default {{.Field.Default}}", p.{{.Field.FieldName}})
+		}
+		{{- end}}
+	})
+	{{- end}}
+}
+{{- end}}
+
+{{- define "values"}}
+{{- range $i, $p := .}}{{if $i}}, {{end}}{{printf "%q" $p.Name}}: { {{- range $j, $v := $p.Values}}{{if $j}}, {{end}}{{printf "%q" $v}}{{end -}} }{{end}}
+{{- end}}
+`))
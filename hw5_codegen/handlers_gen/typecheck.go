@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadPackage type checks the files as a single package, the imports are
+// read from export data. Type errors are left to the compiler, the files
+// may use the code generated from them
+func loadPackage(fset *token.FileSet, files []string) (*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo,
+		Fset: fset,
+	}
+
+	pkgs, err := packages.Load(cfg, files...)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, errors.Errorf("%d packages found, the files must make a single one", len(pkgs))
+	}
+
+	pkg := pkgs[0]
+	for _, err := range pkg.Errors {
+		// building the export data fails with the same type errors,
+		// reported as the compiler output
+		compiler := err.Kind == packages.ListError && strings.HasPrefix(err.Msg, "# ")
+		if err.Kind != packages.TypeError && !compiler {
+			return nil, err
+		}
+	}
+
+	return pkg, nil
+}
+
+// qualify names the types of other packages by their package name
+func (c *Collector) qualify(pkg *types.Package) string {
+	if pkg == c.pkg {
+		return ""
+	}
+	return pkg.Name()
+}
+
+// importSpec returns the import of the package as the generated files
+// refer to it, empty for this package
+func (c *Collector) importSpec(pkg *types.Package) string {
+	if pkg == nil || pkg == c.pkg {
+		return ""
+	}
+	if pkg.Name() != path.Base(pkg.Path()) {
+		return pkg.Name() + " " + pkg.Path()
+	}
+	return pkg.Path()
+}
+
+// typeImports returns the imports needed to name the type
+func (c *Collector) typeImports(t types.Type) []string {
+	var imports []string
+	var walk func(t types.Type)
+	walk = func(t types.Type) {
+		switch t := types.Unalias(t).(type) {
+		case *types.Pointer:
+			walk(t.Elem())
+		case *types.Slice:
+			walk(t.Elem())
+		case *types.Array:
+			walk(t.Elem())
+		case *types.Map:
+			walk(t.Key())
+			walk(t.Elem())
+		case *types.Chan:
+			walk(t.Elem())
+		case *types.Named:
+			if spec := c.importSpec(t.Obj().Pkg()); spec != "" {
+				imports = append(imports, spec)
+			}
+			for i := 0; i < t.TypeArgs().Len(); i++ {
+				walk(t.TypeArgs().At(i))
+			}
+		}
+	}
+	walk(t)
+	return imports
+}
+
+func isNamed(t types.Type, pkgPath, name string) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == pkgPath && named.Obj().Name() == name
+}
+
+// paramsStruct returns the named struct type of the method params
+func paramsStruct(t types.Type) (*types.Named, bool) {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.TypeParams().Len() > 0 {
+		return nil, false
+	}
+	_, ok = named.Underlying().(*types.Struct)
+	return named, ok
+}
+
+// hasParams reports whether the struct type behind t has apivalidator
+// fields, directly or through its embedded fields
+func hasParams(t types.Type, seen map[*types.Named]bool) bool {
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := paramsStruct(t)
+	if !ok || seen[named] {
+		return false
+	}
+	if seen == nil {
+		seen = make(map[*types.Named]bool)
+	}
+	seen[named] = true
+
+	st := named.Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		if _, tagged := reflect.StructTag(st.Tag(i)).Lookup("apivalidator"); tagged {
+			return true
+		}
+		if st.Field(i).Embedded() && hasParams(st.Field(i).Type(), seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// structFields parses the apivalidator tags of a struct type once,
+// problems with the fields are recorded as diagnostics
+func (c *Collector) structFields(obj *types.TypeName) *StructContainer {
+	if structContainer, ok := c.structs[obj]; ok {
+		return structContainer
+	}
+
+	structContainer := &StructContainer{
+		Name:  types.TypeString(obj.Type(), c.qualify),
+		Pos:   obj.Pos(),
+		Local: obj.Pkg() == c.pkg,
+	}
+	if c.structs == nil {
+		c.structs = make(map[*types.TypeName]*StructContainer)
+	}
+	c.structs[obj] = structContainer
+
+	st := obj.Type().Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		validation, tagged := reflect.StructTag(st.Tag(i)).Lookup("apivalidator")
+		if !tagged && (!v.Embedded() || !hasParams(v.Type(), nil)) {
+			// embedded types without params, like sync.Mutex
+			continue
+		}
+
+		field := &StructField{
+			FieldName:  v.Name(),
+			Validation: strings.Split(validation, ","),
+			Embedded:   v.Embedded(),
+			Pos:        v.Pos(),
+		}
+		err := field.setType(v.Type(), c.qualify)
+		if err == nil {
+			err = parseValidation(field)
+		}
+		if err == nil && !v.Exported() && !structContainer.Local {
+			err = errors.New("the unexported field of another package can't be filled")
+		}
+		if err != nil {
+			c.errorf(v.Pos(), "%s.%s: %v", obj.Name(), field.FieldName, err)
+			continue
+		}
+
+		structContainer.Fields = append(structContainer.Fields, field)
+	}
+
+	return structContainer
+}
+
+// taggedStructs returns the struct types of the package having apivalidator
+// or embedded fields, ordered by position
+func (c *Collector) taggedStructs() []*types.TypeName {
+	var objs []*types.TypeName
+	scope := c.pkg.Scope()
+	for _, name := range scope.Names() {
+		obj, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || obj.IsAlias() {
+			continue
+		}
+		if _, ok := paramsStruct(obj.Type()); !ok {
+			continue
+		}
+
+		st := obj.Type().Underlying().(*types.Struct)
+		for i := 0; i < st.NumFields(); i++ {
+			if _, ok := reflect.StructTag(st.Tag(i)).Lookup("apivalidator"); ok || st.Field(i).Embedded() {
+				objs = append(objs, obj)
+				break
+			}
+		}
+	}
+
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].Pos() < objs[j].Pos()
+	})
+	return objs
+}
+
+// resolveAll flattens the params of every handler and of every struct
+// with apivalidator fields, recording the problems as diagnostics
+func (c *Collector) resolveAll() {
+	resolved := make(map[*types.TypeName]*StructContainer)
+	add := func(obj *types.TypeName, pos token.Pos) *StructContainer {
+		if structContainer, ok := resolved[obj]; ok {
+			return structContainer
+		}
+
+		structContainer, err := c.resolveParams(obj, pos)
+		resolved[obj] = structContainer
+		if err != nil {
+			c.diagnostics = append(c.diagnostics, err.(diagnostic))
+			return nil
+		}
+		if len(structContainer.Fields) > 0 {
+			c.StructContainer = append(c.StructContainer, structContainer)
+		}
+		return structContainer
+	}
+
+	for _, obj := range c.taggedStructs() {
+		add(obj, obj.Pos())
+	}
+	for _, handler := range c.HandlerContainer {
+		handler.Struct = add(handler.ParamType.Obj(), handler.ParamPos)
+	}
+}
+
+// setType splits the field type into the scalar type and the pointer or
+// slice around it, named types are validated by their underlying type;
+// other structs are taken for nested params
+func (field *StructField) setType(t types.Type, qualifier types.Qualifier) error {
+	field.FieldType = types.TypeString(t, qualifier)
+
+	t = types.Unalias(t)
+	switch u := t.(type) {
+	case *types.Pointer:
+		field.Pointer = true
+		t = types.Unalias(u.Elem())
+	case *types.Slice:
+		field.Slice = true
+		t = types.Unalias(u.Elem())
+	}
+	field.ElemType = types.TypeString(t, qualifier)
+	if named, ok := t.(*types.Named); ok {
+		field.elemPkg = named.Obj().Pkg()
+	}
+
+	if field.setFileType(t) {
+		return nil
+	}
+
+	if isNamed(t, "time", "Time") {
+		field.BaseType = "time.Time"
+		return nil
+	}
+
+	if basic, ok := t.Underlying().(*types.Basic); ok {
+		switch basic.Kind() {
+		case types.String, types.Int, types.Int64, types.Uint, types.Float64, types.Bool:
+			field.BaseType = basic.Name()
+			return nil
+		}
+	}
+
+	named, ok := paramsStruct(t)
+	if ok && field.Embedded && field.Pointer {
+		return errors.Errorf("the embedded pointer %s can't be filled, embed %s", field.FieldType, field.ElemType)
+	}
+	if ok && !field.Pointer && !field.Slice {
+		field.Nested = field.ElemType
+		field.nested = named.Obj()
+		return nil
+	}
+
+	return errors.Errorf("unsupported type %s", field.FieldType)
+}
+
+// parseHandler reads the annotation and the signature of an api method,
+// problems are recorded as diagnostics and nil is returned
+func (c *Collector) parseHandler(funcDecl *ast.FuncDecl, text string, pos token.Pos) *HandlerContainer {
+	obj := &HandlerContainer{
+		StructMethod: funcDecl.Name.Name,
+		Pos:          funcDecl.Name.Pos(),
+	}
+
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(obj); err != nil {
+		c.errorf(pos, "bad apigen:api annotation: %v", err)
+		return nil
+	}
+
+	fn, ok := c.info.Defs[funcDecl.Name].(*types.Func)
+	if !ok {
+		c.errorf(funcDecl.Name.Pos(), "%s is not type checked", funcDecl.Name.Name)
+		return nil
+	}
+	sig := fn.Type().(*types.Signature)
+
+	if sig.Recv() == nil {
+		c.errorf(funcDecl.Name.Pos(), "apigen:api on the func %s, it must be a method", funcDecl.Name.Name)
+		return nil
+	}
+	recv := types.Unalias(sig.Recv().Type())
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = types.Unalias(ptr.Elem())
+	}
+	named, ok := recv.(*types.Named)
+	if !ok || named.Obj().Pkg() != c.pkg || named.TypeParams().Len() > 0 {
+		c.errorf(funcDecl.Recv.Pos(), "unsupported receiver %s", types.TypeString(sig.Recv().Type(), c.qualify))
+		return nil
+	}
+	obj.Receiver = named.Obj().Name()
+
+	params, results := sig.Params(), sig.Results()
+	if params.Len() != 2 || !isNamed(params.At(0).Type(), "context", "Context") ||
+		results.Len() != 2 || !types.Identical(results.At(1).Type(), types.Universe.Lookup("error").Type()) {
+		c.errorf(funcDecl.Type.Pos(), "%s must have the signature (ctx context.Context, in T) (R, error)", funcDecl.Name.Name)
+		return nil
+	}
+
+	obj.ParamPos = params.At(1).Pos()
+	obj.ParamType, ok = paramsStruct(params.At(1).Type())
+	if !ok {
+		c.errorf(obj.ParamPos, "params of %s must be a struct type, not %s",
+			funcDecl.Name.Name, types.TypeString(params.At(1).Type(), c.qualify))
+		return nil
+	}
+	obj.Param = types.TypeString(obj.ParamType, c.qualify)
+	obj.Result = types.TypeString(results.At(0).Type(), c.qualify)
+	obj.ResultType = results.At(0).Type()
+
+	obj.Method = strings.ToUpper(obj.Method)
+	if obj.MaxBody <= 0 {
+		obj.MaxBody = defaultMaxBody
+	}
+	if obj.Errors != "" && obj.Errors != "all" {
+		c.errorf(pos, "unknown errors mode %q", obj.Errors)
+		return nil
+	}
+	if err := obj.parseLimits(); err != nil {
+		c.errorf(pos, "%v", err)
+		return nil
+	}
+	if err := obj.parseResponse(obj.ResultType, c.qualify); err != nil {
+		c.errorf(pos, "%v", err)
+		return nil
+	}
+
+	return obj
+}
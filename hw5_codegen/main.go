@@ -5,14 +5,16 @@ package main
 
 // этот код закомментирован чтобы он не светился в тестовом покрытии
 
+//go:generate go run ./handlers_gen -client api_client.go -tests api_handlers_test.go -metrics api.go api_handlers.go
+
 import (
 	"fmt"
 	"net/http"
 )
 
 func main() {
-	// будет вызван метод ServeHTTP у структуры MyApi
-	http.Handle("/user/", NewMyApi())
+	// Router раздаёт MyApi под /v1 и OtherApi под /v2, как их ждут клиенты
+	http.Handle("/", NewRouter(NewMyApi(), NewOtherApi()))
 
 	fmt.Println("starting server at :8080")
 	http.ListenAndServe(":8080", nil)
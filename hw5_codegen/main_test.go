@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -20,13 +24,24 @@ var (
 	client = &http.Client{Timeout: time.Second}
 )
 
+func init() {
+	// валидные запросы сгенерированных тестов, на которые api отвечает ошибкой:
+	// пользователей из тестов нет, а созданный повторно уже есть
+	apigenValidStatus["MyApi.Profile"] = http.StatusNotFound
+	apigenValidStatus["MyApi.Status"] = http.StatusNotFound
+	apigenValidStatus["MyApi.ByID"] = http.StatusNotFound
+	apigenValidStatus["MyApi.Create"] = http.StatusConflict
+	apigenValidStatus["AdminApi.Panic"] = http.StatusInternalServerError
+}
+
 type Case struct {
-	Method string // GET по-умолчанию в http.NewRequest если передали пустую строку
-	Path   string
-	Query  string
-	Auth   bool
-	Status int
-	Result interface{}
+	Method      string // GET по-умолчанию в http.NewRequest если передали пустую строку
+	Path        string
+	Query       string
+	ContentType string // для POST, по-умолчанию application/x-www-form-urlencoded
+	Auth        bool
+	Status      int
+	Result      interface{}
 }
 
 const (
@@ -78,90 +93,90 @@ func TestMyApi(t *testing.T) {
 				"error": "login must me not empty",
 			},
 		},
-		// Case{ // получили ошибку общего назначения - ваш код сам подставил 500
-		// 	Path:   ApiUserProfile,
-		// 	Query:  "login=bad_user",
-		// 	Status: http.StatusInternalServerError,
-		// 	Result: CR{
-		// 		"error": "bad user",
-		// 	},
-		// },
-		// Case{ // получили специализированную ошибку - ваш код поставил статус 404 оттуда
-		// 	Path:   ApiUserProfile,
-		// 	Query:  "login=not_exist_user",
-		// 	Status: http.StatusNotFound,
-		// 	Result: CR{
-		// 		"error": "user not exist",
-		// 	},
-		// },
-		// // ------
-		// Case{ // это должен ответить ваш ServeHTTP - если ему пришло что-то неизвестное (например когда он обрабатывает /user/)
-		// 	Path:   "/user/unknown",
-		// 	Query:  "login=not_exist_user",
-		// 	Status: http.StatusNotFound,
-		// 	Result: CR{
-		// 		"error": "unknown method",
-		// 	},
-		// },
-		// // ------
-		// Case{ // создаём юзера
-		// 	Path:   ApiUserCreate,
-		// 	Method: http.MethodPost,
-		// 	Query:  "login=mr.moderator&age=32&status=moderator&full_name=Ivan_Ivanov",
-		// 	Status: http.StatusOK,
-		// 	Auth:   true,
-		// 	Result: CR{
-		// 		"error": "",
-		// 		"response": CR{
-		// 			"id": 43,
-		// 		},
-		// 	},
-		// },
-		// Case{ // юзер действительно создался
-		// 	Path:   ApiUserProfile,
-		// 	Query:  "login=mr.moderator",
-		// 	Status: http.StatusOK,
-		// 	Result: CR{
-		// 		"error": "",
-		// 		"response": CR{
-		// 			"id":        43,
-		// 			"login":     "mr.moderator",
-		// 			"full_name": "Ivan_Ivanov",
-		// 			"status":    10,
-		// 		},
-		// 	},
-		// },
-
-		// Case{ // только POST
-		// 	Path:   ApiUserCreate,
-		// 	Method: http.MethodGet,
-		// 	Query:  "login=mr.moderator&age=32&status=moderator&full_name=GetMethod",
-		// 	Status: http.StatusNotAcceptable,
-		// 	Auth:   true,
-		// 	Result: CR{
-		// 		"error": "bad method",
-		// 	},
-		// },
-		// Case{
-		// 	Path:   ApiUserCreate,
-		// 	Method: http.MethodPost,
-		// 	Query:  "any_params=123",
-		// 	Status: http.StatusForbidden,
-		// 	Auth:   false,
-		// 	Result: CR{
-		// 		"error": "unauthorized",
-		// 	},
-		// },
-		// Case{
-		// 	Path:   ApiUserCreate,
-		// 	Method: http.MethodPost,
-		// 	Query:  "login=mr.moderator&age=32&status=moderator&full_name=New_Ivan",
-		// 	Status: http.StatusConflict,
-		// 	Auth:   true,
-		// 	Result: CR{
-		// 		"error": "user mr.moderator exist",
-		// 	},
-		// },
+		Case{ // получили ошибку общего назначения - ваш код сам подставил 500
+			Path:   ApiUserProfile,
+			Query:  "login=bad_user",
+			Status: http.StatusInternalServerError,
+			Result: CR{
+				"error": "bad user",
+			},
+		},
+		Case{ // получили специализированную ошибку - ваш код поставил статус 404 оттуда
+			Path:   ApiUserProfile,
+			Query:  "login=not_exist_user",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "user not exist",
+			},
+		},
+		// ------
+		Case{ // это должен ответить ваш ServeHTTP - если ему пришло что-то неизвестное (например когда он обрабатывает /user/)
+			Path:   "/user/unknown",
+			Query:  "login=not_exist_user",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+		// ------
+		Case{ // создаём юзера
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=mr.moderator&age=32&status=moderator&full_name=Ivan_Ivanov",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id": 43,
+				},
+			},
+		},
+		Case{ // юзер действительно создался
+			Path:   ApiUserProfile,
+			Query:  "login=mr.moderator",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        43,
+					"login":     "mr.moderator",
+					"full_name": "Ivan_Ivanov",
+					"status":    10,
+				},
+			},
+		},
+
+		Case{ // только POST
+			Path:   ApiUserCreate,
+			Method: http.MethodGet,
+			Query:  "login=mr.moderator&age=32&status=moderator&full_name=GetMethod",
+			Status: http.StatusNotAcceptable,
+			Auth:   true,
+			Result: CR{
+				"error": "bad method",
+			},
+		},
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "any_params=123",
+			Status: http.StatusForbidden,
+			Auth:   false,
+			Result: CR{
+				"error": "unauthorized",
+			},
+		},
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=mr.moderator&age=32&status=moderator&full_name=New_Ivan",
+			Status: http.StatusConflict,
+			Auth:   true,
+			Result: CR{
+				"error": "user mr.moderator exist",
+			},
+		},
 		Case{
 			Path:   ApiUserCreate,
 			Method: http.MethodPost,
@@ -182,16 +197,16 @@ func TestMyApi(t *testing.T) {
 				"error": "login len must be >= 10",
 			},
 		},
-		// Case{
-		// 	Path:   ApiUserCreate,
-		// 	Method: http.MethodPost,
-		// 	Query:  "login=new_moderator&age=ten&status=moderator&full_name=Ivan_Ivanov",
-		// 	Status: http.StatusBadRequest,
-		// 	Auth:   true,
-		// 	Result: CR{
-		// 		"error": "age must be int",
-		// 	},
-		// },
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=new_moderator&age=ten&status=moderator&full_name=Ivan_Ivanov",
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "age must be int",
+			},
+		},
 		Case{
 			Path:   ApiUserCreate,
 			Method: http.MethodPost,
@@ -212,78 +227,781 @@ func TestMyApi(t *testing.T) {
 				"error": "age must be <= 128",
 			},
 		},
-		// Case{
-		// 	Path:   ApiUserCreate,
-		// 	Method: http.MethodPost,
-		// 	Query:  "login=new_moderator&age=32&status=adm&full_name=Ivan_Ivanov",
-		// 	Status: http.StatusBadRequest,
-		// 	Auth:   true,
-		// 	Result: CR{
-		// 		"error": "status must be one of [user, moderator, admin]",
-		// 	},
-		// },
-		// Case{ // status по-умолчанию
-		// 	Path:   ApiUserCreate,
-		// 	Method: http.MethodPost,
-		// 	Query:  "login=new_moderator3&age=32&full_name=Ivan_Ivanov",
-		// 	Status: http.StatusOK,
-		// 	Auth:   true,
-		// 	Result: CR{
-		// 		"error": "",
-		// 		"response": CR{
-		// 			"id": 44,
-		// 		},
-		// 	},
-		// },
-		// Case{ // обрабатываем неизвестную ошибку
-		// 	Path:   ApiUserCreate,
-		// 	Method: http.MethodPost,
-		// 	Query:  "login=bad_username&age=32&full_name=Ivan_Ivanov",
-		// 	Status: http.StatusInternalServerError,
-		// 	Auth:   true,
-		// 	Result: CR{
-		// 		"error": "bad user",
-		// 	},
-		// },
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=new_moderator&age=32&status=adm&full_name=Ivan_Ivanov",
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "status must be one of [user, moderator, admin]",
+			},
+		},
+		Case{ // status по-умолчанию
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=new_moderator3&age=32&full_name=Ivan_Ivanov",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id": 44,
+				},
+			},
+		},
+		Case{ // обрабатываем неизвестную ошибку
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=bad_username&age=32&full_name=Ivan_Ivanov",
+			Status: http.StatusInternalServerError,
+			Auth:   true,
+			Result: CR{
+				"error": "bad user",
+			},
+		},
 	}
 
 	runTests(t, ts, cases)
 }
 
-// func TestOtherApi(t *testing.T) {
-// 	ts := httptest.NewServer(NewOtherApi())
-//
-// 	cases := []Case{
-// 		Case{
-// 			Path:   ApiUserCreate,
-// 			Method: http.MethodPost,
-// 			Query:  "username=I3apBap&level=1&class=barbarian&account_name=Vasily",
-// 			Status: http.StatusBadRequest,
-// 			Auth:   true,
-// 			Result: CR{
-// 				"error": "class must be one of [warrior, sorcerer, rouge]",
-// 			},
-// 		},
-// 		Case{
-// 			Path:   ApiUserCreate,
-// 			Method: http.MethodPost,
-// 			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
-// 			Status: http.StatusOK,
-// 			Auth:   true,
-// 			Result: CR{
-// 				"error": "",
-// 				"response": CR{
-// 					"id":        12,
-// 					"login":     "I3apBap",
-// 					"full_name": "Vasily",
-// 					"level":     1,
-// 				},
-// 			},
-// 		},
-// 	}
-//
-// 	runTests(t, ts, cases)
-// }
+func TestOtherApi(t *testing.T) {
+	ts := httptest.NewServer(NewOtherApi())
+
+	cases := []Case{
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=barbarian&account_name=Vasily",
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "class must be one of [warrior, sorcerer, rouge]",
+			},
+		},
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        12,
+					"login":     "I3apBap",
+					"full_name": "Vasily",
+					"level":     1,
+				},
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestAdminApiValidation(t *testing.T) {
+	ts := httptest.NewServer(NewAdminApi())
+
+	const apiInvite = "/admin/invite"
+	cases := []Case{
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"email": "v@mail.ru",
+					"role":  "user",
+					"team":  "",
+					"nick":  "",
+				},
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&site=https://mail.ru&token=6ba7b810-9dad-11d1-80b4-00c04fd430c8&role=moderator&team=go&from=1&till=2&nick=v_romanov",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"email": "v@mail.ru",
+					"role":  "moderator",
+					"team":  "go",
+					"nick":  "v_romanov",
+				},
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v.mail.ru&code=abc123",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "email must be email",
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&site=mail.ru",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "site must be url",
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&token=6ba7b810",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "token must be uuid",
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&role=admin",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "role must be one of [user, moderator]",
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "code len must be 6",
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&nick=1v",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "nick must match ^[a-z][a-z0-9_]*$",
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&from=3&till=2",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "till must be >= from",
+			},
+		},
+		Case{
+			// till не задан - сравнивается нулевое значение
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&from=2",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "till must be >= from",
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&from=2&till=2",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"email": "v@mail.ru",
+					"role":  "user",
+					"team":  "",
+					"nick":  "",
+				},
+			},
+		},
+		Case{
+			Path:   apiInvite,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&role=moderator",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "team must me not empty when role is moderator",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestAdminApiAllErrors(t *testing.T) {
+	ts := httptest.NewServer(NewAdminApi())
+
+	const apiCheck = "/admin/invite/check"
+	cases := []Case{
+		Case{
+			Path:   apiCheck,
+			Method: http.MethodPost,
+			Query:  "email=v@mail.ru&code=abc123&nick=v_romanov",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"email": "v@mail.ru",
+					"role":  "user",
+					"team":  "",
+					"nick":  "v_romanov",
+				},
+			},
+		},
+		Case{
+			Path:   apiCheck,
+			Method: http.MethodPost,
+			Query:  "email=v.mail.ru&code=abc&nick=1_very_long_nickname&role=moderator&from=2&till=1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "validation failed",
+				"fields": []CR{
+					CR{"param": "email", "rule": "email", "message": "email must be email"},
+					CR{"param": "code", "rule": "len", "message": "code len must be 6"},
+					CR{"param": "nick", "rule": "pattern", "message": "nick must match ^[a-z][a-z0-9_]*$"},
+					CR{"param": "nick", "rule": "max", "message": "nick len must be <= 16"},
+					CR{"param": "team", "rule": "required_if", "message": "team must me not empty when role is moderator"},
+					CR{"param": "till", "rule": "gtefield", "message": "till must be >= from"},
+				},
+			},
+		},
+		Case{
+			// незаполненное поле дальше не проверяется
+			Path:   apiCheck,
+			Method: http.MethodPost,
+			Query:  "code=abc123&till=abc",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "validation failed",
+				"fields": []CR{
+					CR{"param": "email", "rule": "required", "message": "email must me not empty"},
+					CR{"param": "till", "rule": "type", "message": "till must be int"},
+				},
+			},
+		},
+		Case{
+			// для "errors": "all" без ошибок валидации ответ прежний
+			Path:   apiCheck,
+			Method: http.MethodGet,
+			Status: http.StatusNotAcceptable,
+			Result: CR{
+				"error": "bad method",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestAdminApiMiddlewares(t *testing.T) {
+	api := NewAdminApi()
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	for _, query := range []string{"email=a@mail.ru&code=abc123", "email=b.mail.ru&code=abc123", "email=b@mail.ru&code=abc123"} {
+		resp, err := client.Post(ts.URL+"/admin/invite", "application/x-www-form-urlencoded", strings.NewReader(query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header["X-Middleware"]; !reflect.DeepEqual(got, []string{"outer", "inner"}) {
+			t.Errorf("[%s] middlewares order: %v", query, got)
+		}
+	}
+
+	// параметры невалидного запроса до middleware не доходят
+	if want := []string{"a@mail.ru", "b@mail.ru"}; !reflect.DeepEqual(api.invited, want) {
+		t.Errorf("invited: got %v, want %v", api.invited, want)
+	}
+
+	runTests(t, ts, []Case{
+		Case{
+			Path:   "/admin/panic",
+			Status: http.StatusInternalServerError,
+			Result: CR{
+				"error": "internal error",
+			},
+		},
+		Case{
+			// сервер пережил панику
+			Path:   "/admin/panic",
+			Status: http.StatusInternalServerError,
+			Result: CR{
+				"error": "internal error",
+			},
+		},
+	})
+
+	// по разу на /admin/invite и /admin/panic
+	if api.middlewaresCalls != 2 {
+		t.Errorf("Middlewares called %d times", api.middlewaresCalls)
+	}
+}
+
+func TestAdminApiLimits(t *testing.T) {
+	ts := httptest.NewServer(NewAdminApi())
+	defer ts.Close()
+
+	runTests(t, ts, []Case{
+		Case{
+			Path:   "/admin/report",
+			Auth:   true,
+			Status: http.StatusOK,
+			Result: CR{
+				"error":    "",
+				"response": CR{"invited": 0},
+			},
+		},
+		Case{
+			// не уложились в timeout
+			Path:   "/admin/report",
+			Query:  "delay=1000",
+			Auth:   true,
+			Status: http.StatusGatewayTimeout,
+			Result: CR{
+				"error": "timeout",
+			},
+		},
+		Case{
+			// без авторизации лимит не тратится
+			Path:   "/admin/report",
+			Status: http.StatusForbidden,
+			Result: CR{
+				"error": "unauthorized",
+			},
+		},
+	})
+
+	// 2 запроса в минуту на токен исчерпаны
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/admin/report", nil)
+	req.Header.Set("X-Auth", "100500")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want 429", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After: got %q, want 30", got)
+	}
+
+	// чужой токен не проходит авторизацию, а не получает новый лимит
+	req.Header.Set("X-Auth", "100501")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("rotated token: got status %d, want 403", resp.StatusCode)
+	}
+}
+
+// scrapeMetrics возвращает значения метрик по строкам вида name{labels}
+func scrapeMetrics(t *testing.T, url string) map[string]float64 {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	metrics := make(map[string]float64)
+	for _, line := range strings.Split(string(body), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[sep+1:], 64)
+		if err != nil {
+			t.Fatalf("bad metric %q", line)
+		}
+		metrics[line[:sep]] = value
+	}
+	return metrics
+}
+
+func TestMetricsHandler(t *testing.T) {
+	// api живёт под /user/, его /metrics снаружи не виден
+	mux := http.NewServeMux()
+	mux.Handle("/user/", NewMyApi())
+	mux.Handle("/metrics", MetricsHandler())
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	before := scrapeMetrics(t, ts.URL+"/metrics")
+	for _, path := range []string{"/user/profile?login=rvasily", "/user/profile?login=rvasily", "/user/profile", "/user/profile?login=not_exist"} {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	after := scrapeMetrics(t, ts.URL+"/metrics")
+
+	const labels = `receiver="MyApi",url="/user/profile",method="ANY"`
+	for name, want := range map[string]float64{
+		`apigen_requests_total{` + labels + `}`:                            4,
+		`apigen_request_errors_total{` + labels + `,code="400"}`:           1,
+		`apigen_request_errors_total{` + labels + `,code="404"}`:           1,
+		`apigen_request_duration_seconds_count{` + labels + `}`:            4,
+		`apigen_request_duration_seconds_bucket{` + labels + `,le="+Inf"}`: 4,
+	} {
+		if got := after[name] - before[name]; got != want {
+			t.Errorf("%s: got %v more, want %v", name, got, want)
+		}
+	}
+	if _, ok := after[`apigen_requests_total{receiver="OtherApi",url="/user/create",method="POST"}`]; !ok {
+		t.Errorf("no metrics of OtherApi")
+	}
+}
+
+func TestRouter(t *testing.T) {
+	ts := httptest.NewServer(NewRouter(NewMyApi(), NewOtherApi()))
+	defer ts.Close()
+
+	cases := []Case{
+		Case{
+			Path:   "/v1" + ApiUserProfile,
+			Query:  "login=rvasily",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        42,
+					"login":     "rvasily",
+					"full_name": "Vasily Romanov",
+					"status":    20,
+				},
+			},
+		},
+		Case{
+			Path:   "/v1/user/rvasily/status",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"login":  "rvasily",
+					"status": "admin",
+				},
+			},
+		},
+		Case{
+			Path:   "/v2" + ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        12,
+					"login":     "I3apBap",
+					"full_name": "Vasily",
+					"level":     1,
+				},
+			},
+		},
+		Case{
+			// без префикса api не видно
+			Path:   ApiUserProfile,
+			Query:  "login=rvasily",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+		Case{
+			// у OtherApi нет profile
+			Path:   "/v2" + ApiUserProfile,
+			Query:  "login=rvasily",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+		Case{
+			Path:   "/v3" + ApiUserProfile,
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+
+	// клиенты по-умолчанию ходят через Router
+	ctx := context.Background()
+	user, err := NewMyApiClient(ts.URL).Profile(ctx, ProfileParams{Login: "rvasily"})
+	if err != nil || user.ID != 42 {
+		t.Errorf("v1 client: got %#v, %v", user, err)
+	}
+	other := NewOtherApiClient(ts.URL)
+	other.Token = "100500"
+	created, err := other.Create(ctx, OtherCreateParams{Username: "I3apBap", Level: 1})
+	if err != nil || created.ID != 12 || created.Login != "I3apBap" {
+		t.Errorf("v2 client: got %#v, %v", created, err)
+	}
+}
+
+func TestMyApiPathParams(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+
+	cases := []Case{
+		Case{ // login из пути
+			Path:   "/user/rvasily/status",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"login":  "rvasily",
+					"status": "admin",
+				},
+			},
+		},
+		Case{
+			Path:   "/user/not_exist_user/status",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "user not exist",
+			},
+		},
+		Case{ // экранированный слэш остаётся внутри сегмента
+			Path:   "/user/rvasily%2Fstatus/status",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "user not exist",
+			},
+		},
+		Case{ // параметр пути важнее query
+			Path:   "/user/id/42",
+			Query:  "id=43",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        42,
+					"login":     "rvasily",
+					"full_name": "Vasily Romanov",
+					"status":    20,
+				},
+			},
+		},
+		Case{
+			Path:   "/user/id/abc",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "id must be uint",
+			},
+		},
+		Case{ // /user/id/{id} раньше /user/{login}/status
+			Path:   "/user/id/status",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "id must be uint",
+			},
+		},
+		Case{
+			Path:   "/user/id/0",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "id must me not empty",
+			},
+		},
+		Case{
+			Path:   "/user/rvasily/status/more",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestMyApiJSON(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+
+	cases := []Case{
+		Case{ // параметры в json
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Query:       `{"login": "mr.json_user", "age": 32, "status": "moderator", "full_name": "Json User"}`,
+			ContentType: "application/json",
+			Status:      http.StatusOK,
+			Auth:        true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id": 43,
+				},
+			},
+		},
+		Case{
+			Path:   ApiUserProfile,
+			Query:  "login=mr.json_user",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        43,
+					"login":     "mr.json_user",
+					"full_name": "Json User",
+					"status":    10,
+				},
+			},
+		},
+		Case{ // число строкой
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Query:       `{"login": "mr.json_user2", "age": "32"}`,
+			ContentType: "application/json; charset=utf-8",
+			Status:      http.StatusBadRequest,
+			Auth:        true,
+			Result: CR{
+				"error": "age must be int",
+			},
+		},
+		Case{ // массив вместо строки
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Query:       `{"login": "mr.json_user2", "status": ["user", "admin"]}`,
+			ContentType: "application/json",
+			Status:      http.StatusBadRequest,
+			Auth:        true,
+			Result: CR{
+				"error": "status must be string",
+			},
+		},
+		Case{
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Query:       `{"login": "mr.json_user2"`,
+			ContentType: "application/json",
+			Status:      http.StatusBadRequest,
+			Auth:        true,
+			Result: CR{
+				"error": "bad json",
+			},
+		},
+		Case{ // тело больше лимита
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Query:       `{"login": "` + strings.Repeat("x", 1<<20) + `"}`,
+			ContentType: "application/json",
+			Status:      http.StatusRequestEntityTooLarge,
+			Auth:        true,
+			Result: CR{
+				"error": "request body too large",
+			},
+		},
+		Case{
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Query:       "login=mr.json_user2",
+			ContentType: "text/plain",
+			Status:      http.StatusUnsupportedMediaType,
+			Auth:        true,
+			Result: CR{
+				"error": "unsupported content type",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestCreateParamsValidate(t *testing.T) {
+	in := CreateParams{Login: "rvasily_go", Age: 32}
+	if err := in.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if in.Status != "user" {
+		t.Errorf("default status: got %q", in.Status)
+	}
+
+	in = CreateParams{Login: "rvasily", Status: "root", Age: 129}
+	err := in.Validate()
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %#v, want ValidationErrors", err)
+	}
+	want := []string{"login len must be >= 10", "status must be one of [user, moderator, admin]", "age must be <= 128"}
+	if len(errs) != len(want) {
+		t.Fatalf("got %v, want %v", err, want)
+	}
+	for i, e := range errs {
+		if e.Message != want[i] {
+			t.Errorf("error %d: got %q, want %q", i, e.Message, want[i])
+		}
+	}
+
+	// FillFrom проверяет так же, как Validate
+	fillErr := (&CreateParams{}).FillFrom(url.Values{"login": {"rvasily"}, "status": {"root"}, "age": {"129"}})
+	if fillErr == nil || fillErr.Error() != err.Error() {
+		t.Errorf("FillFrom: got %v, want %v", fillErr, err)
+	}
+}
+
+func TestMyApiClient(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := NewMyApiClient(ts.URL)
+	c.Prefix = "" // api без Router
+	c.Token = "100500"
+
+	user, err := c.Profile(ctx, ProfileParams{Login: "rvasily"})
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	if user.ID != 42 || user.FullName != "Vasily Romanov" {
+		t.Errorf("profile: got %#v", user)
+	}
+
+	var apiErr ApiError
+	_, err = c.Profile(ctx, ProfileParams{Login: "not_exist_user"})
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusNotFound || err.Error() != "user not exist" {
+		t.Errorf("profile of unknown user: got %#v", err)
+	}
+
+	created, err := c.Create(ctx, CreateParams{Login: "mr.client_user", Name: "Client", Age: 20})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	user, err = c.Profile(ctx, ProfileParams{Login: "mr.client_user"})
+	if err != nil {
+		t.Fatalf("profile of created user: %v", err)
+	}
+	if user.ID != created.ID || user.FullName != "Client" || user.Status != statusUser {
+		t.Errorf("profile of created user: got %#v", user)
+	}
+
+	_, err = c.Create(ctx, CreateParams{Login: "mr.client_user", Age: 20})
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusConflict {
+		t.Errorf("create existing user: got %#v", err)
+	}
+
+	c.Token = ""
+	_, err = c.Create(ctx, CreateParams{Login: "mr.anonymous_user"})
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusForbidden || err.Error() != "unauthorized" {
+		t.Errorf("create without token: got %#v", err)
+	}
+}
 
 func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 	for idx, item := range cases {
@@ -294,12 +1012,20 @@ func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 			req      *http.Request
 		)
 
-		caseName := fmt.Sprintf("case %d: [%s] %s %s", idx, item.Method, item.Path, item.Query)
+		query := item.Query
+		if len(query) > 100 {
+			query = query[:100] + "..."
+		}
+		caseName := fmt.Sprintf("case %d: [%s] %s %s", idx, item.Method, item.Path, query)
 
 		if item.Method == http.MethodPost {
 			reqBody := strings.NewReader(item.Query)
 			req, err = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
-			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			contentType := item.ContentType
+			if contentType == "" {
+				contentType = "application/x-www-form-urlencoded"
+			}
+			req.Header.Add("Content-Type", contentType)
 		} else {
 			req, err = http.NewRequest(item.Method, ts.URL+item.Path+"?"+item.Query, nil)
 		}